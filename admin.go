@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/KSlashh/test-eth/config"
+	"github.com/KSlashh/test-eth/log"
+)
+
+// applyLogLevels sets the module levels of levels, "default" being the level
+// of the default logger and so of every module without its own level, info
+// when not given.
+func applyLogLevels(levels map[string]string) error {
+	modules := map[string]int{log.DefaultModule: log.InfoLog}
+	for name, s := range levels {
+		level, err := log.ParseLevel(s)
+		if err != nil {
+			return fmt.Errorf("LogLevels %s: %v", name, err)
+		}
+		modules[name] = level
+	}
+	return log.SetModuleLevels(modules)
+}
+
+// reloadLogLevelsOnHup applies the LogLevels of the configuration file again
+// on every SIGHUP, so levels can be changed without restarting a long test.
+func reloadLogLevelsOnHup() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			conf, err := config.LoadConfig(confFile)
+			if err == nil {
+				err = applyLogLevels(conf.LogLevels)
+			}
+			if err != nil {
+				log.Errorf("reload log levels fail: %v", err)
+				continue
+			}
+			log.Info("Log levels reloaded", "file", confFile)
+		}
+	}()
+}
+
+// serveAdmin exposes log.LevelHandler at http://addr/log/levels.
+func serveAdmin(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/log/levels", log.LevelHandler())
+	go func() {
+		log.Infof("Serving admin at http://%s/log/levels", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("admin server stopped: %v", err)
+		}
+	}()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"errors"
+	"github.com/KSlashh/test-eth/units"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -11,74 +12,89 @@ import (
 	"math/big"
 )
 
-func TransferEth(client *ethclient.Client, privateKeyHex string, toAddressHex string, amount *big.Int) (txHash [32]byte, err error) {
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
-	if err != nil {
-		return common.Hash{}, err
-	}
-
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return common.Hash{}, errors.New("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
-	}
+// GasPrice and TransferGasLimit are used by every transfer, main sets them
+// from the network config.
+var GasPrice = units.NewAmountOf(1, units.Gwei)
+var TransferGasLimit uint64 = 21000
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+func TransferEth(ctx context.Context, client *ethclient.Client, privateKeyHex string, toAddressHex string, amount *units.Amount) (txHash [32]byte, err error) {
+	signedTx, err := SignTransfer(ctx, client, privateKeyHex, toAddressHex, amount)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
-	gasLimit := uint64(21000)
-	gasPrice := big.NewInt(1000000000)
+	err = client.SendTransaction(ctx, signedTx)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
-	toAddress := common.HexToAddress(toAddressHex)
-	var data []byte
-	tx := types.NewTransaction(nonce, toAddress, amount, gasLimit, gasPrice, data)
+	return signedTx.Hash(), nil
+}
+
+// NonceReader looks up the pending nonce of an account, an ethclient.Client
+// or an Endpoint which batches the lookups.
+type NonceReader interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// SignTransfer signs a transfer of amount with the pending nonce of the sender.
+func SignTransfer(ctx context.Context, client *ethclient.Client, privateKeyHex string, toAddressHex string, amount *units.Amount) (*types.Transaction, error) {
+	return signTransfer(ctx, client, client, privateKeyHex, toAddressHex, amount)
+}
 
-	chainID, err := client.ChainID(context.Background())
+// signTransfer is SignTransfer with the nonce looked up through nonces.
+func signTransfer(ctx context.Context, client *ethclient.Client, nonces NonceReader, privateKeyHex string, toAddressHex string, amount *units.Amount) (*types.Transaction, error) {
+	privateKey, err := crypto.HexToECDSA(privateKeyHex)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
 	}
 
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+	publicKey := privateKey.Public()
+	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("cannot assert type: publicKey is not of type *ecdsa.PublicKey")
+	}
+
+	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
+	nonce, err := nonces.PendingNonceAt(ctx, fromAddress)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
 	}
 
-	err = client.SendTransaction(context.Background(), signedTx)
+	toAddress := common.HexToAddress(toAddressHex)
+	var data []byte
+	tx := types.NewTransaction(nonce, toAddress, amount.Int(), TransferGasLimit, GasPrice.Int(), data)
+
+	signer, err := Signer(ctx, client)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
 	}
 
-	return signedTx.Hash(), nil
+	return types.SignTx(tx, signer, privateKey)
 }
 
-func GetBalance(client *ethclient.Client, addressHex string) (balance *big.Int, err error) {
+func GetBalance(ctx context.Context, client *ethclient.Client, addressHex string) (balance *units.Amount, err error) {
 	account := common.HexToAddress(addressHex)
-	b, err := client.BalanceAt(context.Background(), account, nil)
+	b, err := client.BalanceAt(ctx, account, nil)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	return units.NewAmount(b), nil
 }
 
-func GetBalanceAt(client *ethclient.Client, addressHex string, height int64) (balance *big.Int, err error) {
+func GetBalanceAt(ctx context.Context, client *ethclient.Client, addressHex string, height int64) (balance *units.Amount, err error) {
 	account := common.HexToAddress(addressHex)
 	blockNumber := big.NewInt(height)
-	b, err := client.BalanceAt(context.Background(), account, blockNumber)
+	b, err := client.BalanceAt(ctx, account, blockNumber)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	return units.NewAmount(b), nil
 }
 
-func GetBlockHeader(client *ethclient.Client, height int64) (header *types.Header, err error) {
+func GetBlockHeader(ctx context.Context, client *ethclient.Client, height int64) (header *types.Header, err error) {
 	blockNumber := big.NewInt(height)
-	header, err = client.HeaderByNumber(context.Background(), blockNumber)
+	header, err = client.HeaderByNumber(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var DefaultBatchSize = 100
+var DefaultBatchFlushInterval = time.Millisecond * 50
+
+// batchTimeout bounds one batch request, so that a stalled node does not block
+// the calls queued after it.
+var batchTimeout = time.Second * 10
+
+// batchCall is decoded into its own raw result, the result of the caller is
+// only filled by Call itself so that a caller which gave up is never written.
+type batchCall struct {
+	elem rpc.BatchElem
+	raw  json.RawMessage
+	done chan error
+}
+
+// Batcher queues json-rpc calls from many goroutines and sends them to the node
+// as one batch request, either when size calls are queued or every interval.
+type Batcher struct {
+	client   *rpc.Client
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []*batchCall
+	flushCh chan struct{}
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewBatcher(client *rpc.Client, size int, interval time.Duration) *Batcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultBatchFlushInterval
+	}
+	b := &Batcher{
+		client:   client,
+		size:     size,
+		interval: interval,
+		flushCh:  make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b
+}
+
+// DialBatcher dials url and returns a Batcher on top of the new connection.
+func DialBatcher(url string, size int, interval time.Duration) (*Batcher, error) {
+	client, err := DialRPC(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewBatcher(client, size, interval), nil
+}
+
+func (b *Batcher) loop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.flushCh:
+			b.flush()
+		case <-b.quit:
+			b.flush()
+			return
+		}
+	}
+}
+
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	calls := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for len(calls) > 0 {
+		n := len(calls)
+		if n > b.size {
+			n = b.size
+		}
+		b.send(calls[:n])
+		calls = calls[n:]
+	}
+}
+
+func (b *Batcher) send(calls []*batchCall) {
+	elems := make([]rpc.BatchElem, len(calls))
+	for i, c := range calls {
+		elems[i] = c.elem
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+	err := b.client.BatchCallContext(ctx, elems)
+	for i, c := range calls {
+		if err != nil {
+			c.done <- err
+		} else {
+			c.done <- elems[i].Error
+		}
+	}
+}
+
+func (b *Batcher) Size() int {
+	return b.size
+}
+
+// Call queues one json-rpc call and blocks until its batch has been answered
+// or ctx is done.
+func (b *Batcher) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	c := &batchCall{done: make(chan error, 1)}
+	c.elem = rpc.BatchElem{Method: method, Args: args, Result: &c.raw}
+	b.mu.Lock()
+	b.pending = append(b.pending, c)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	select {
+	case err := <-c.done:
+		if err != nil || result == nil {
+			return err
+		}
+		return json.Unmarshal(c.raw, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return b.Call(ctx, nil, "eth_sendRawTransaction", hexutil.Encode(data))
+}
+
+func (b *Batcher) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var r *types.Receipt
+	err := b.Call(ctx, &r, "eth_getTransactionReceipt", txHash)
+	if err == nil && r == nil {
+		return nil, ethereum.NotFound
+	}
+	return r, err
+}
+
+func (b *Batcher) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var result hexutil.Big
+	err := b.Call(ctx, &result, "eth_getBalance", account, toBlockNumArg(blockNumber))
+	return (*big.Int)(&result), err
+}
+
+func (b *Batcher) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var result hexutil.Uint64
+	err := b.Call(ctx, &result, "eth_getTransactionCount", account, toBlockNumArg(blockNumber))
+	return uint64(result), err
+}
+
+func (b *Batcher) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var result hexutil.Uint64
+	err := b.Call(ctx, &result, "eth_getTransactionCount", account, "pending")
+	return uint64(result), err
+}
+
+// Close flushes the queued calls and stops the batcher. The underlying
+// rpc client is left open.
+func (b *Batcher) Close() {
+	close(b.quit)
+	b.wg.Wait()
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
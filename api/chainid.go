@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// chainIDs caches the chain ID of every client, it is asked once per
+// connection instead of once per tx.
+var chainIDs = struct {
+	sync.Mutex
+	ids map[*ethclient.Client]*big.Int
+}{ids: map[*ethclient.Client]*big.Int{}}
+
+// ChainID returns the chain ID of the node behind client.
+func ChainID(ctx context.Context, client *ethclient.Client) (*big.Int, error) {
+	chainIDs.Lock()
+	id, ok := chainIDs.ids[client]
+	chainIDs.Unlock()
+	if ok {
+		return id, nil
+	}
+	id, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainIDs.Lock()
+	chainIDs.ids[client] = id
+	chainIDs.Unlock()
+	return id, nil
+}
+
+// SignerName selects the signer of every tx, main sets it from the config.
+var SignerName = "latest"
+
+// Signer returns the signer named by SignerName for the chain of client, by
+// default the one of the latest forks so that typed txns are signed right on
+// chains which enabled them.
+func Signer(ctx context.Context, client *ethclient.Client) (types.Signer, error) {
+	id, err := ChainID(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	switch SignerName {
+	case "london":
+		return types.NewLondonSigner(id), nil
+	case "berlin":
+		return types.NewEIP2930Signer(id), nil
+	case "eip155":
+		return types.NewEIP155Signer(id), nil
+	case "homestead":
+		return types.HomesteadSigner{}, nil
+	default:
+		return types.LatestSignerForChainID(id), nil
+	}
+}
+
+// CheckChainID asks the chain ID of every endpoint and fails when they are
+// not on the same chain, or not on expected when it is not 0.
+func (p *ClientPool) CheckChainID(ctx context.Context, expected uint64) (*big.Int, error) {
+	var first *big.Int
+	for _, e := range p.endpoints {
+		id, err := ChainID(ctx, e.Client)
+		if err != nil {
+			return nil, fmt.Errorf("get chain id of %s: %v", e.Url, err)
+		}
+		if expected != 0 && id.Cmp(new(big.Int).SetUint64(expected)) != 0 {
+			return nil, fmt.Errorf("%s is on chain %s, configured network is chain %d", e.Url, id, expected)
+		}
+		if first != nil && id.Cmp(first) != 0 {
+			return nil, fmt.Errorf("%s is on chain %s, %s on chain %s", e.Url, id, p.endpoints[0].Url, first)
+		}
+		first = id
+	}
+	return first, nil
+}
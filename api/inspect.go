@@ -0,0 +1,333 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// The views below are the decoded, printable forms of blocks, txns and
+// receipts. Amounts are written to json as wei strings so that json
+// consumers do not lose precision.
+
+type BlockView struct {
+	Number       uint64        `json:"number"`
+	Hash         common.Hash   `json:"hash"`
+	ParentHash   common.Hash   `json:"parentHash"`
+	Time         uint64        `json:"timestamp"`
+	TimeUTC      string        `json:"time"`
+	Miner        string        `json:"miner"`
+	GasUsed      uint64        `json:"gasUsed"`
+	GasLimit     uint64        `json:"gasLimit"`
+	BaseFee      *units.Amount `json:"baseFee,omitempty"`
+	Size         uint64        `json:"size"`
+	TxCount      int           `json:"txCount"`
+	Transactions []common.Hash `json:"transactions"`
+	Zion         *ZionHeader   `json:"zion,omitempty"`
+}
+
+type TxView struct {
+	Hash        common.Hash     `json:"hash"`
+	Type        uint8           `json:"type"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Nonce       uint64          `json:"nonce"`
+	Value       *units.Amount   `json:"value"`
+	Gas         uint64          `json:"gas"`
+	GasPrice    *units.Amount   `json:"gasPrice"`
+	Input       hexutil.Bytes   `json:"input"`
+	Pending     bool            `json:"pending"`
+	BlockNumber *uint64         `json:"blockNumber,omitempty"`
+}
+
+type LogView struct {
+	Index   uint                   `json:"logIndex"`
+	Address common.Address         `json:"address"`
+	Topics  []common.Hash          `json:"topics"`
+	Data    hexutil.Bytes          `json:"data"`
+	Event   string                 `json:"event,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+
+	argNames []string // the keys of Args in the order of the event inputs
+}
+
+type ReceiptView struct {
+	TxHash            common.Hash     `json:"transactionHash"`
+	BlockNumber       uint64          `json:"blockNumber"`
+	BlockHash         common.Hash     `json:"blockHash"`
+	Status            string          `json:"status"`
+	GasUsed           uint64          `json:"gasUsed"`
+	CumulativeGasUsed uint64          `json:"cumulativeGasUsed"`
+	ContractAddress   *common.Address `json:"contractAddress,omitempty"`
+	EffectiveGasPrice *units.Amount   `json:"effectiveGasPrice"`
+	Fee               *units.Amount   `json:"fee"`
+	Logs              []LogView       `json:"logs"`
+}
+
+// LoadABI reads a contract abi json file, used to decode receipt logs.
+func LoadABI(path string) (*abi.ABI, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	parsed, err := abi.JSON(f)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func GetBlockView(ctx context.Context, client *ethclient.Client, height *big.Int) (*BlockView, error) {
+	block, err := client.BlockByNumber(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	v := &BlockView{
+		Number:     block.NumberU64(),
+		Hash:       block.Hash(),
+		ParentHash: block.ParentHash(),
+		Time:       block.Time(),
+		TimeUTC:    time.Unix(int64(block.Time()), 0).UTC().Format(time.RFC3339),
+		Miner:      block.Coinbase().Hex(),
+		GasUsed:    block.GasUsed(),
+		GasLimit:   block.GasLimit(),
+		Size:       uint64(block.Size()),
+		TxCount:    len(block.Transactions()),
+	}
+	if block.BaseFee() != nil {
+		v.BaseFee = units.NewAmount(block.BaseFee())
+	}
+	for _, tx := range block.Transactions() {
+		v.Transactions = append(v.Transactions, tx.Hash())
+	}
+	if zion, err := DecodeZionHeader(block.Header()); err == nil {
+		v.Zion = zion
+	}
+	return v, nil
+}
+
+func GetTxView(ctx context.Context, client *ethclient.Client, hash common.Hash) (*TxView, error) {
+	tx, pending, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// the configured signer is for signing only, the latest one recovers the
+	// sender of every tx type
+	chainID, err := ChainID(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return nil, fmt.Errorf("recover sender: %v", err)
+	}
+	v := &TxView{
+		Hash:     tx.Hash(),
+		Type:     tx.Type(),
+		From:     from,
+		To:       tx.To(),
+		Nonce:    tx.Nonce(),
+		Value:    units.NewAmount(tx.Value()),
+		Gas:      tx.Gas(),
+		GasPrice: units.NewAmount(tx.GasPrice()),
+		Input:    tx.Data(),
+		Pending:  pending,
+	}
+	if !pending {
+		receipt, err := client.TransactionReceipt(ctx, hash)
+		if err == nil {
+			number := receipt.BlockNumber.Uint64()
+			v.BlockNumber = &number
+		}
+	}
+	return v, nil
+}
+
+// GetReceiptView decodes the receipt of hash, logs of events found in
+// contractAbi are decoded too, contractAbi may be nil.
+func GetReceiptView(ctx context.Context, client *ethclient.Client, hash common.Hash, contractAbi *abi.ABI) (*ReceiptView, error) {
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	tx, _, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	header, err := client.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	price := tx.GasPrice()
+	if tx.Type() == types.DynamicFeeTxType && header.BaseFee != nil {
+		price = new(big.Int).Add(header.BaseFee, tx.GasTipCap())
+		if price.Cmp(tx.GasFeeCap()) > 0 {
+			price = tx.GasFeeCap()
+		}
+	}
+	fee := new(big.Int).Mul(price, new(big.Int).SetUint64(receipt.GasUsed))
+	v := &ReceiptView{
+		TxHash:            receipt.TxHash,
+		BlockNumber:       receipt.BlockNumber.Uint64(),
+		BlockHash:         receipt.BlockHash,
+		Status:            "failed",
+		GasUsed:           receipt.GasUsed,
+		CumulativeGasUsed: receipt.CumulativeGasUsed,
+		EffectiveGasPrice: units.NewAmount(price),
+		Fee:               units.NewAmount(fee),
+		Logs:              []LogView{},
+	}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		v.Status = "success"
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		addr := receipt.ContractAddress
+		v.ContractAddress = &addr
+	}
+	for _, l := range receipt.Logs {
+		v.Logs = append(v.Logs, decodeLog(l, contractAbi))
+	}
+	return v, nil
+}
+
+func decodeLog(l *types.Log, contractAbi *abi.ABI) LogView {
+	v := LogView{Index: l.Index, Address: l.Address, Topics: l.Topics, Data: l.Data}
+	if contractAbi == nil || len(l.Topics) == 0 {
+		return v
+	}
+	event, err := contractAbi.EventByID(l.Topics[0])
+	if err != nil {
+		return v
+	}
+	args := map[string]interface{}{}
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(args, l.Data); err != nil {
+		return v
+	}
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, l.Topics[1:]); err != nil {
+		return v
+	}
+	v.Event = event.Sig
+	v.Args = args
+	for _, input := range event.Inputs {
+		v.argNames = append(v.argNames, input.Name)
+	}
+	return v
+}
+
+// textWriter lays out "key: value" lines for the text output of the views.
+type textWriter struct {
+	b      strings.Builder
+	indent string
+}
+
+func (w *textWriter) add(key string, value interface{}) {
+	fmt.Fprintf(&w.b, "%s%-20s %v\n", w.indent, key+":", value)
+}
+
+func (v *BlockView) String() string {
+	w := new(textWriter)
+	w.add("Number", v.Number)
+	w.add("Hash", v.Hash.Hex())
+	w.add("ParentHash", v.ParentHash.Hex())
+	w.add("Time", fmt.Sprintf("%d (%s)", v.Time, v.TimeUTC))
+	w.add("Miner", v.Miner)
+	w.add("GasUsed", fmt.Sprintf("%d (%.2f%% of %d)", v.GasUsed, fill(v.GasUsed, v.GasLimit)*100, v.GasLimit))
+	if v.BaseFee != nil {
+		w.add("BaseFee", v.BaseFee)
+	}
+	w.add("Size", fmt.Sprintf("%d bytes", v.Size))
+	w.add("TxCount", v.TxCount)
+	for i, h := range v.Transactions {
+		w.add(fmt.Sprintf("  Tx[%d]", i), h.Hex())
+	}
+	if v.Zion != nil {
+		w.add("Proposer", v.Zion.Proposer.Hex())
+		if v.Zion.EndHeight > 0 {
+			w.add("Epoch", fmt.Sprintf("%d - %d", v.Zion.StartHeight, v.Zion.EndHeight))
+		}
+		for i, a := range v.Zion.Validators {
+			w.add(fmt.Sprintf("  Validator[%d]", i), a.Hex())
+		}
+		for i, a := range v.Zion.Committers {
+			w.add(fmt.Sprintf("  CommittedSeal[%d]", i), a.Hex())
+		}
+	}
+	return w.b.String()
+}
+
+func fill(used, limit uint64) float64 {
+	if limit == 0 {
+		return 0
+	}
+	return float64(used) / float64(limit)
+}
+
+func (v *TxView) String() string {
+	w := new(textWriter)
+	w.add("Hash", v.Hash.Hex())
+	w.add("Type", v.Type)
+	w.add("From", v.From.Hex())
+	if v.To != nil {
+		w.add("To", v.To.Hex())
+	} else {
+		w.add("To", "(contract creation)")
+	}
+	w.add("Nonce", v.Nonce)
+	w.add("Value", v.Value)
+	w.add("Gas", v.Gas)
+	w.add("GasPrice", v.GasPrice)
+	w.add("Input", hexutil.Encode(v.Input))
+	if v.Pending {
+		w.add("Status", "pending")
+	} else if v.BlockNumber != nil {
+		w.add("BlockNumber", *v.BlockNumber)
+	}
+	return w.b.String()
+}
+
+func (v *ReceiptView) String() string {
+	w := new(textWriter)
+	w.add("TxHash", v.TxHash.Hex())
+	w.add("Block", fmt.Sprintf("%d (%s)", v.BlockNumber, v.BlockHash.Hex()))
+	w.add("Status", v.Status)
+	w.add("GasUsed", v.GasUsed)
+	w.add("EffectiveGasPrice", v.EffectiveGasPrice)
+	w.add("Fee", v.Fee)
+	if v.ContractAddress != nil {
+		w.add("ContractAddress", v.ContractAddress.Hex())
+	}
+	for _, l := range v.Logs {
+		w.add(fmt.Sprintf("Log[%d]", l.Index), l.Address.Hex())
+		w.indent = "  "
+		if l.Event != "" {
+			w.add("Event", l.Event)
+			for _, k := range l.argNames {
+				w.add(k, l.Args[k])
+			}
+		} else {
+			for i, t := range l.Topics {
+				w.add(fmt.Sprintf("Topic[%d]", i), t.Hex())
+			}
+			w.add("Data", hexutil.Encode(l.Data))
+		}
+		w.indent = ""
+	}
+	return w.b.String()
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/metrics"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// latency histogram bucket upper bounds, the last bucket is +Inf
+var latencyBuckets = []time.Duration{
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second * 1,
+	time.Millisecond * 2500,
+	time.Second * 5,
+	time.Second * 10,
+}
+
+type MethodStats struct {
+	Calls        uint64
+	Errors       uint64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	Buckets      []uint64 // len(latencyBuckets)+1, not cumulative
+}
+
+func (s *MethodStats) AverageLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+// Quantile estimates the q quantile latency from the histogram, returning the
+// upper bound of the bucket it falls in.
+func (s *MethodStats) Quantile(q float64) time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.Calls))
+	var seen uint64
+	for i, n := range s.Buckets {
+		seen += n
+		if seen > rank || seen == s.Calls {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			return s.MaxLatency
+		}
+	}
+	return s.MaxLatency
+}
+
+// RPCStats counts calls, errors and latency per json-rpc method.
+type RPCStats struct {
+	mu      sync.Mutex
+	methods map[string]*MethodStats
+}
+
+var Stats = NewRPCStats()
+
+var rpcLog = log.Module("rpc")
+
+func init() {
+	metrics.Register("rpc", Stats.WriteMetrics)
+}
+
+func NewRPCStats() *RPCStats {
+	return &RPCStats{methods: map[string]*MethodStats{}}
+}
+
+func (r *RPCStats) Observe(method string, latency time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.methods[method]
+	if !ok {
+		s = &MethodStats{Buckets: make([]uint64, len(latencyBuckets)+1)}
+		r.methods[method] = s
+	}
+	s.Calls++
+	if failed {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+	s.Buckets[i]++
+}
+
+// Snapshot returns a copy of the stats keyed by method.
+func (r *RPCStats) Snapshot() map[string]MethodStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]MethodStats, len(r.methods))
+	for method, s := range r.methods {
+		c := *s
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		res[method] = c
+	}
+	return res
+}
+
+func sortedMethods(snap map[string]MethodStats) []string {
+	methods := make([]string, 0, len(snap))
+	for method := range snap {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Report logs one line per json-rpc method.
+func (r *RPCStats) Report() {
+	snap := r.Snapshot()
+	for _, method := range sortedMethods(snap) {
+		s := snap[method]
+		rpcLog.Infof("Rpc %s: "+
+			"Calls: %d, "+
+			"Errors: %d, "+
+			"Average-Latency: %d ms, "+
+			"P50-Latency: <= %d ms, "+
+			"P99-Latency: <= %d ms, "+
+			"Max-Latency: %d ms",
+			method,
+			s.Calls,
+			s.Errors,
+			s.AverageLatency().Milliseconds(),
+			s.Quantile(0.5).Milliseconds(),
+			s.Quantile(0.99).Milliseconds(),
+			s.MaxLatency.Milliseconds(),
+		)
+	}
+}
+
+func (r *RPCStats) WriteMetrics(w io.Writer) {
+	snap := r.Snapshot()
+	methods := sortedMethods(snap)
+	fmt.Fprintln(w, "# TYPE rpc_calls_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "rpc_calls_total{method=%q} %d\n", method, snap[method].Calls)
+	}
+	fmt.Fprintln(w, "# TYPE rpc_errors_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "rpc_errors_total{method=%q} %d\n", method, snap[method].Errors)
+	}
+	fmt.Fprintln(w, "# TYPE rpc_latency_seconds histogram")
+	for _, method := range methods {
+		s := snap[method]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += s.Buckets[i]
+			fmt.Fprintf(w, "rpc_latency_seconds_bucket{method=%q,le=\"%g\"} %d\n", method, bound.Seconds(), cumulative)
+		}
+		fmt.Fprintf(w, "rpc_latency_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", method, s.Calls)
+		fmt.Fprintf(w, "rpc_latency_seconds_sum{method=%q} %g\n", method, s.TotalLatency.Seconds())
+		fmt.Fprintf(w, "rpc_latency_seconds_count{method=%q} %d\n", method, s.Calls)
+	}
+}
+
+type jsonrpcRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+type jsonrpcResponse struct {
+	ID    json.RawMessage `json:"id"`
+	Error json.RawMessage `json:"error"`
+}
+
+// instrumentedTransport records every json-rpc call that goes through it,
+// a batch request counts as one call per method in the batch.
+type instrumentedTransport struct {
+	base  http.RoundTripper
+	stats *RPCStats
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	calls := parseRequests(body)
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode/100 != 2 {
+		latency := time.Since(start)
+		for _, c := range calls {
+			t.stats.Observe(c.Method, latency, true)
+			rpcLog.Debug("rpc call failed", "method", c.Method, "ms", latency.Milliseconds(), "err", err)
+		}
+		return resp, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	failed := parseFailedIDs(respBody)
+	for _, c := range calls {
+		t.stats.Observe(c.Method, latency, err != nil || failed[string(c.ID)])
+		rpcLog.Debug("rpc call", "method", c.Method, "ms", latency.Milliseconds(), "failed", failed[string(c.ID)])
+	}
+	return resp, nil
+}
+
+func parseRequests(body []byte) []jsonrpcRequest {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []jsonrpcRequest
+		json.Unmarshal(trimmed, &batch)
+		return batch
+	}
+	var single jsonrpcRequest
+	if json.Unmarshal(trimmed, &single) != nil {
+		return nil
+	}
+	return []jsonrpcRequest{single}
+}
+
+func parseFailedIDs(body []byte) map[string]bool {
+	var resps []jsonrpcResponse
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		json.Unmarshal(trimmed, &resps)
+	} else {
+		var single jsonrpcResponse
+		json.Unmarshal(trimmed, &single)
+		resps = append(resps, single)
+	}
+	failed := map[string]bool{}
+	for _, r := range resps {
+		if len(r.Error) > 0 && string(r.Error) != "null" {
+			failed[string(r.ID)] = true
+		}
+	}
+	return failed
+}
+
+// DialRPC dials url with every http call recorded in Stats. Websocket and ipc
+// connections are dialed as they are and not instrumented.
+func DialRPC(url string) (*rpc.Client, error) {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		httpClient := &http.Client{Transport: &instrumentedTransport{base: http.DefaultTransport, stats: Stats}}
+		return rpc.DialHTTPWithClient(url, httpClient)
+	}
+	return rpc.DialContext(context.Background(), url)
+}
+
+// Dial is ethclient.Dial on top of DialRPC.
+func Dial(url string) (*ethclient.Client, error) {
+	c, err := DialRPC(url)
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(c), nil
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var apiLog = log.Module("api")
+
+const (
+	RoundRobin = "round-robin"
+	Weighted   = "weighted"
+	Sticky     = "sticky"
+)
+
+var HealthCheckTimeout = time.Second * 3
+
+// Endpoint is one node of a ClientPool together with its send statistics.
+type Endpoint struct {
+	// accessed atomically, keep 64-bit aligned
+	sent     uint64
+	failed   uint64
+	failover uint64
+
+	Url    string
+	Weight int
+	Client *ethclient.Client
+	Rpc    *rpc.Client
+	// Batcher batches the calls to this node, nil unless batching is enabled
+	Batcher *Batcher
+
+	healthy       int32
+	currentWeight int
+}
+
+func (e *Endpoint) Healthy() bool {
+	return atomic.LoadInt32(&e.healthy) == 1
+}
+
+func (e *Endpoint) setHealthy(ok bool) {
+	if ok {
+		atomic.StoreInt32(&e.healthy, 1)
+	} else {
+		atomic.StoreInt32(&e.healthy, 0)
+	}
+}
+
+// SendTransaction sends tx to the node, through the Batcher when batching is
+// enabled.
+func (e *Endpoint) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if e.Batcher != nil {
+		return e.Batcher.SendTransaction(ctx, tx)
+	}
+	return e.Client.SendTransaction(ctx, tx)
+}
+
+// BalanceAt, NonceAt and PendingNonceAt go through the Batcher too.
+func (e *Endpoint) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	if e.Batcher != nil {
+		return e.Batcher.BalanceAt(ctx, account, blockNumber)
+	}
+	return e.Client.BalanceAt(ctx, account, blockNumber)
+}
+
+func (e *Endpoint) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	if e.Batcher != nil {
+		return e.Batcher.NonceAt(ctx, account, blockNumber)
+	}
+	return e.Client.NonceAt(ctx, account, blockNumber)
+}
+
+func (e *Endpoint) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	if e.Batcher != nil {
+		return e.Batcher.PendingNonceAt(ctx, account)
+	}
+	return e.Client.PendingNonceAt(ctx, account)
+}
+
+func (e *Endpoint) record(err error) {
+	if err != nil {
+		atomic.AddUint64(&e.failed, 1)
+	} else {
+		atomic.AddUint64(&e.sent, 1)
+	}
+}
+
+// ClientPool spreads sends across several nodes and fails over to the next
+// healthy node when one stops answering.
+type ClientPool struct {
+	counter   uint64 // accessed atomically, keep 64-bit aligned
+	endpoints []*Endpoint
+	strategy  string
+	mu        sync.Mutex // guards currentWeight of endpoints
+	quit      chan struct{}
+}
+
+func NewClientPool(urls []string, weights []int, strategy string) (*ClientPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no endpoint given")
+	}
+	switch strategy {
+	case "":
+		strategy = RoundRobin
+	case RoundRobin, Weighted, Sticky:
+	default:
+		return nil, fmt.Errorf("unknown load balance strategy %s", strategy)
+	}
+	p := &ClientPool{strategy: strategy, quit: make(chan struct{})}
+	for i, url := range urls {
+		rpcClient, err := DialRPC(url)
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %v", url, err)
+		}
+		weight := 1
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+		p.endpoints = append(p.endpoints, &Endpoint{
+			Url:     url,
+			Weight:  weight,
+			Client:  ethclient.NewClient(rpcClient),
+			Rpc:     rpcClient,
+			healthy: 1,
+		})
+	}
+	return p, nil
+}
+
+// EnableBatch gives every endpoint its own Batcher, sends then go out as
+// json-rpc batches of up to size calls.
+func (p *ClientPool) EnableBatch(size int, interval time.Duration) {
+	for _, e := range p.endpoints {
+		e.Batcher = NewBatcher(e.Rpc, size, interval)
+	}
+}
+
+// BatchSize is the size of the batches, 0 when batching is disabled.
+func (p *ClientPool) BatchSize() int {
+	if b := p.endpoints[0].Batcher; b != nil {
+		return b.Size()
+	}
+	return 0
+}
+
+func (p *ClientPool) Endpoints() []*Endpoint {
+	return p.endpoints
+}
+
+// Client returns the client of the endpoint picked for key.
+func (p *ClientPool) Client(key uint64) *ethclient.Client {
+	return p.Next(key).Client
+}
+
+// Next picks a healthy endpoint according to the pool strategy, key is only
+// used by the sticky strategy so that one sender always hits the same node.
+// When every endpoint is down the first one is returned.
+func (p *ClientPool) Next(key uint64) *Endpoint {
+	healthy := make([]*Endpoint, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		return p.endpoints[0]
+	}
+	switch p.strategy {
+	case Sticky:
+		return healthy[key%uint64(len(healthy))]
+	case Weighted:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		total := 0
+		var best *Endpoint
+		for _, e := range healthy {
+			e.currentWeight += e.Weight
+			total += e.Weight
+			if best == nil || e.currentWeight > best.currentWeight {
+				best = e
+			}
+		}
+		best.currentWeight -= total
+		return best
+	default:
+		n := atomic.AddUint64(&p.counter, 1)
+		return healthy[n%uint64(len(healthy))]
+	}
+}
+
+// isNodeDown tells transport failures apart from errors the node answered with.
+func isNodeDown(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var httpErr rpc.HTTPError
+	return errors.As(err, &netErr) || errors.As(err, &httpErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// do runs f on the endpoint picked for key and retries on the other endpoints
+// when the node could not be reached.
+func (p *ClientPool) do(ctx context.Context, key uint64, f func(e *Endpoint) error) error {
+	e := p.Next(key)
+	var err error
+	for i := 0; i < len(p.endpoints); i++ {
+		err = f(e)
+		if ctx.Err() != nil {
+			return err
+		}
+		e.record(err)
+		if !isNodeDown(err) {
+			return err
+		}
+		e.setHealthy(false)
+		atomic.AddUint64(&e.failover, 1)
+		apiLog.Warnf("endpoint %s is down, fail over: %v", e.Url, err)
+		e = p.Next(key)
+	}
+	return err
+}
+
+func (p *ClientPool) SendTransaction(ctx context.Context, key uint64, tx *types.Transaction) error {
+	return p.do(ctx, key, func(e *Endpoint) error {
+		return e.SendTransaction(ctx, tx)
+	})
+}
+
+// TransferEth signs and sends a transfer, sendTime is taken right before the
+// signed tx is sent, after the nonce lookup. Both go through the Batcher of the
+// endpoint when batching is enabled.
+func (p *ClientPool) TransferEth(ctx context.Context, key uint64, privateKeyHex string, toAddressHex string, amount *units.Amount) (txHash [32]byte, sendTime time.Time, err error) {
+	err = p.do(ctx, key, func(e *Endpoint) error {
+		tx, err := signTransfer(ctx, e.Client, e, privateKeyHex, toAddressHex, amount)
+		if err != nil {
+			return err
+		}
+		sendTime = time.Now()
+		if err := e.SendTransaction(ctx, tx); err != nil {
+			return err
+		}
+		txHash = tx.Hash()
+		return nil
+	})
+	return txHash, sendTime, err
+}
+
+// StartHealthCheck probes every endpoint each interval until Close is called.
+func (p *ClientPool) StartHealthCheck(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkHealth()
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (p *ClientPool) checkHealth() {
+	for _, e := range p.endpoints {
+		ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+		_, err := e.Client.BlockNumber(ctx)
+		cancel()
+		if err != nil && e.Healthy() {
+			apiLog.Warnf("endpoint %s failed health check: %v", e.Url, err)
+		} else if err == nil && !e.Healthy() {
+			apiLog.Infof("endpoint %s is back", e.Url)
+		}
+		e.setHealthy(err == nil)
+	}
+}
+
+// Report logs the send statistics of every endpoint.
+func (p *ClientPool) Report() {
+	for _, e := range p.endpoints {
+		apiLog.Infof("Endpoint %s: "+
+			"Healthy: %t, "+
+			"Sent-Txns: %d, "+
+			"Failed-Txns: %d, "+
+			"Failover: %d",
+			e.Url,
+			e.Healthy(),
+			atomic.LoadUint64(&e.sent),
+			atomic.LoadUint64(&e.failed),
+			atomic.LoadUint64(&e.failover),
+		)
+	}
+}
+
+func (p *ClientPool) Close() {
+	close(p.quit)
+	for _, e := range p.endpoints {
+		if e.Batcher != nil {
+			e.Batcher.Close()
+		}
+		e.Client.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TxpoolStatus returns the number of pending and queued txns in the node's
+// txpool, it fails when the node does not expose the txpool namespace.
+func TxpoolStatus(ctx context.Context, client *rpc.Client) (pending uint64, queued uint64, err error) {
+	var status map[string]hexutil.Uint
+	err = client.CallContext(ctx, &status, "txpool_status")
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(status["pending"]), uint64(status["queued"]), nil
+}
+
+// TxpoolInspect counts the txns listed by txpool_inspect, for nodes which
+// expose it but not txpool_status.
+func TxpoolInspect(ctx context.Context, client *rpc.Client) (pending uint64, queued uint64, err error) {
+	var content map[string]map[string]map[string]string
+	err = client.CallContext(ctx, &content, "txpool_inspect")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, nonces := range content["pending"] {
+		pending += uint64(len(nonces))
+	}
+	for _, nonces := range content["queued"] {
+		queued += uint64(len(nonces))
+	}
+	return pending, queued, nil
+}
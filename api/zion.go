@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Zion HotStuff headers carry HotstuffExtraVanity bytes of vanity followed by
+// the rlp encoded HotstuffExtra in header.Extra.
+const HotstuffExtraVanity = 32
+
+// msgCommit is appended to the block hash before signing a committed seal,
+// the same way istanbul does.
+const msgCommit = 2
+
+// HotstuffExtra is the extra-data layout of Zion blocks.
+type HotstuffExtra struct {
+	StartHeight   uint64
+	EndHeight     uint64
+	Validators    []common.Address
+	Seal          []byte
+	CommittedSeal [][]byte
+	Salt          []byte
+}
+
+// legacyHotstuffExtra is the layout used by Zion before epochs were added.
+type legacyHotstuffExtra struct {
+	Validators    []common.Address
+	Seal          []byte
+	CommittedSeal [][]byte
+	Salt          []byte
+}
+
+// ZionHeader is the decoded consensus data of one Zion block.
+type ZionHeader struct {
+	Number      uint64           `json:"number"`
+	Validators  []common.Address `json:"validators"` // empty when the block does not carry the set
+	Proposer    common.Address   `json:"proposer"`
+	Committers  []common.Address `json:"committers"`  // signers of the committed seals
+	StartHeight uint64           `json:"startHeight"` // epoch range, 0 for legacy extra-data
+	EndHeight   uint64           `json:"endHeight"`
+}
+
+func ExtractHotstuffExtra(header *types.Header) (extra *HotstuffExtra, legacy bool, err error) {
+	if len(header.Extra) < HotstuffExtraVanity {
+		return nil, false, errors.New("extra-data shorter than vanity, not a Zion header")
+	}
+	payload := header.Extra[HotstuffExtraVanity:]
+	extra = new(HotstuffExtra)
+	if err = rlp.DecodeBytes(payload, extra); err == nil {
+		return extra, false, nil
+	}
+	old := new(legacyHotstuffExtra)
+	if rlp.DecodeBytes(payload, old) != nil {
+		return nil, false, fmt.Errorf("decode hotstuff extra: %v", err)
+	}
+	return &HotstuffExtra{
+		Validators:    old.Validators,
+		Seal:          old.Seal,
+		CommittedSeal: old.CommittedSeal,
+		Salt:          old.Salt,
+	}, true, nil
+}
+
+// hotstuffSigHash is the hash signed by the proposer: the header hash with
+// seal, committed seals and salt removed from the extra-data.
+func hotstuffSigHash(header *types.Header, extra *HotstuffExtra, legacy bool) (common.Hash, error) {
+	var payload []byte
+	var err error
+	if legacy {
+		payload, err = rlp.EncodeToBytes(&legacyHotstuffExtra{
+			Validators:    extra.Validators,
+			Seal:          []byte{},
+			CommittedSeal: [][]byte{},
+			Salt:          []byte{},
+		})
+	} else {
+		payload, err = rlp.EncodeToBytes(&HotstuffExtra{
+			StartHeight:   extra.StartHeight,
+			EndHeight:     extra.EndHeight,
+			Validators:    extra.Validators,
+			Seal:          []byte{},
+			CommittedSeal: [][]byte{},
+			Salt:          []byte{},
+		})
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+	filtered := types.CopyHeader(header)
+	filtered.Extra = append(append([]byte{}, header.Extra[:HotstuffExtraVanity]...), payload...)
+	return filtered.Hash(), nil
+}
+
+func recoverSigner(data []byte, sig []byte) (common.Address, error) {
+	pub, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// DecodeZionHeader recovers the proposer and committed seal signers of header.
+func DecodeZionHeader(header *types.Header) (*ZionHeader, error) {
+	extra, legacy, err := ExtractHotstuffExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	sigHash, err := hotstuffSigHash(header, extra, legacy)
+	if err != nil {
+		return nil, err
+	}
+	res := &ZionHeader{
+		Number:      header.Number.Uint64(),
+		Validators:  extra.Validators,
+		StartHeight: extra.StartHeight,
+		EndHeight:   extra.EndHeight,
+	}
+	if len(extra.Seal) > 0 {
+		res.Proposer, err = recoverSigner(sigHash.Bytes(), extra.Seal)
+		if err != nil {
+			return nil, fmt.Errorf("recover proposer: %v", err)
+		}
+	}
+	committed := append(sigHash.Bytes(), msgCommit)
+	for _, seal := range extra.CommittedSeal {
+		signer, err := recoverSigner(committed, seal)
+		if err != nil {
+			return nil, fmt.Errorf("recover committed seal: %v", err)
+		}
+		res.Committers = append(res.Committers, signer)
+	}
+	return res, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// command is one "<group> <name>" subcommand. flags defines its flags on fs
+// and returns the action run once they are parsed. Only commands with args,
+// the usage of their positional arguments, accept any, read from fs.Args().
+type command struct {
+	group   string
+	name    string
+	summary string
+	args    string
+	flags   func(fs *flag.FlagSet) func(ctx context.Context) error
+}
+
+func (c *command) String() string {
+	return c.group + " " + c.name
+}
+
+var commands []*command
+
+func register(c *command) {
+	commands = append(commands, c)
+}
+
+func findCommand(group, name string) *command {
+	for _, c := range commands {
+		if c.group == group && c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// usageError is bad input, reported with the usage of the command and exit
+// status 2. Any other error of an action exits with 1.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] <group> <command> [flags]\n\nCommands:\n", os.Args[0])
+	sorted := append([]*command(nil), commands...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].group < sorted[j].group })
+	for _, c := range sorted {
+		fmt.Fprintf(out, "  %-20s %s\n", c, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s <group> <command> -h' for the flags of a command.\n\nGlobal flags:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// runCommand parses args of c and runs it, returning the exit status.
+func runCommand(ctx context.Context, c *command, args []string) int {
+	fs := flag.NewFlagSet(c.String(), flag.ContinueOnError)
+	action := c.flags(fs)
+	fs.Usage = func() {
+		args := ""
+		if c.args != "" {
+			args = " " + c.args
+		}
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]%s\n\n%s\n\nFlags:\n", os.Args[0], c, args, c.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 && c.args == "" {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	err := action(ctx)
+	var uerr *usageError
+	if errors.As(err, &uerr) {
+		fmt.Fprintln(fs.Output(), uerr.msg)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c, err)
+		return 1
+	}
+	return 0
+}
+
+// amountValue is a flag taking an amount, a number without unit is read in unit.
+type amountValue struct {
+	amount **units.Amount
+	unit   units.Unit
+}
+
+func amountFlag(fs *flag.FlagSet, name string, value *units.Amount, unit units.Unit, usage string) **units.Amount {
+	p := new(*units.Amount)
+	*p = value
+	fs.Var(&amountValue{amount: p, unit: unit}, name, usage+" (e.g. 1.5ether, 20gwei, 1000wei; default unit "+unit.Name+")")
+	return p
+}
+
+func (v *amountValue) String() string {
+	if v.amount == nil || *v.amount == nil {
+		return ""
+	}
+	return strings.ReplaceAll((*v.amount).String(), " ", "")
+}
+
+func (v *amountValue) Set(s string) error {
+	a, err := units.ParseAmount(s, v.unit)
+	if err != nil {
+		return err
+	}
+	*v.amount = a
+	return nil
+}
+
+// addressValue is a flag taking a hex address.
+type addressValue struct {
+	address *common.Address
+	set     bool
+}
+
+func addressFlag(fs *flag.FlagSet, name, usage string) *addressValue {
+	v := &addressValue{address: new(common.Address)}
+	fs.Var(v, name, usage)
+	return v
+}
+
+func (v *addressValue) String() string {
+	if v.address == nil || !v.set {
+		return ""
+	}
+	return v.address.Hex()
+}
+
+func (v *addressValue) Set(s string) error {
+	if !common.IsHexAddress(s) {
+		return fmt.Errorf("not a hex address: %q", s)
+	}
+	*v.address = common.HexToAddress(s)
+	v.set = true
+	return nil
+}
+
+// hashValue is a flag taking a 32 bytes hex hash.
+type hashValue struct {
+	hash *common.Hash
+	set  bool
+}
+
+func hashFlag(fs *flag.FlagSet, name, usage string) *hashValue {
+	v := &hashValue{hash: new(common.Hash)}
+	fs.Var(v, name, usage)
+	return v
+}
+
+func (v *hashValue) String() string {
+	if v.hash == nil || !v.set {
+		return ""
+	}
+	return v.hash.Hex()
+}
+
+func (v *hashValue) Set(s string) error {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return fmt.Errorf("not a 32 bytes hex hash: %q", s)
+	}
+	*v.hash = common.BytesToHash(b)
+	v.set = true
+	return nil
+}
+
+// heightValue is a flag taking a block number or "latest", latest is nil.
+type heightValue struct {
+	height *big.Int
+}
+
+func heightFlag(fs *flag.FlagSet, name, usage string) *heightValue {
+	v := new(heightValue)
+	fs.Var(v, name, usage+" or latest")
+	return v
+}
+
+func (v *heightValue) String() string {
+	if v.height == nil {
+		return "latest"
+	}
+	return v.height.String()
+}
+
+func (v *heightValue) Set(s string) error {
+	if s == "latest" {
+		v.height = nil
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not a block number: %q", s)
+	}
+	v.height = new(big.Int).SetUint64(n)
+	return nil
+}
@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/config"
+	"github.com/KSlashh/test-eth/local"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/KSlashh/test-eth/testUtils"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var testChain *local.Chain
+
+func TestMain(m *testing.M) {
+	// seal a block as soon as a tx is pending
+	chain, err := local.Start("127.0.0.1:0", 0)
+	if err != nil {
+		panic(err)
+	}
+	testChain = chain
+	profile := config.DefaultProfile()
+	profile.ConfirmPollInterval = 20
+	testUtils.SetProfile(&profile)
+	flushInterval = time.Millisecond * 200
+	code := m.Run()
+	chain.Close()
+	os.Exit(code)
+}
+
+func testPool(t *testing.T) *api.ClientPool {
+	pool, err := api.NewClientPool([]string{testChain.URL()}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// startCoordinator serves c on a free localhost port, the result file of its
+// run is written to the returned path and its error sent on the channel.
+func startCoordinator(t *testing.T, c *Coordinator) (string, string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := filepath.Join(t.TempDir(), "result.json")
+	testUtils.EnableReport("", result, nil)
+	t.Cleanup(func() { testUtils.EnableReport("", "", nil) })
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Serve(context.Background(), listener)
+	}()
+	return "http://" + listener.Addr().String(), result, errc
+}
+
+func waitRun(t *testing.T, errc chan error, timeout time.Duration) {
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("coordinator: %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("the coordinator did not finish")
+	}
+}
+
+func readResult(t *testing.T, path string) *report.Run {
+	run, err := report.ReadJSONFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return run
+}
+
+func TestWorkers(t *testing.T) {
+	scenario := Scenario{Instances: 2, InitEther: units.NewAmountOf(1, units.Ether), Rounds: 2}
+	url, result, errc := startCoordinator(t, NewCoordinator(testPool(t), 3, scenario, 0, time.Second))
+	workerErrs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		pool := testPool(t)
+		go func(name string) {
+			workerErrs <- RunWorker(context.Background(), url, name, pool, testChain.PrivateKey())
+		}(fmt.Sprintf("worker-%d", i))
+	}
+	waitRun(t, errc, time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := <-workerErrs; err != nil {
+			t.Errorf("worker: %v", err)
+		}
+	}
+	// 3 workers of 2 instances, 2 rounds of 2 txns
+	if run := readResult(t, result); run.Metrics.Succeeded != 24 {
+		t.Errorf("aggregated %d succeeded txns, want 24", run.Metrics.Succeeded)
+	}
+}
+
+func TestLostWorker(t *testing.T) {
+	timeout := heartbeatTimeout
+	heartbeatTimeout = time.Second * 2
+	defer func() { heartbeatTimeout = timeout }()
+
+	scenario := Scenario{Instances: 1, InitEther: units.NewAmountOf(1, units.Ether), Rounds: 2}
+	url, result, errc := startCoordinator(t, NewCoordinator(testPool(t), 2, scenario, 0, time.Second))
+	// a worker which dies right after it registered
+	go post(context.Background(), &http.Client{}, url+"/register", Register{Worker: "dead"}, &Assignment{})
+	workerErr := make(chan error, 1)
+	pool := testPool(t)
+	go func() {
+		workerErr <- RunWorker(context.Background(), url, "alive", pool, testChain.PrivateKey())
+	}()
+	waitRun(t, errc, time.Minute)
+	if err := <-workerErr; err != nil {
+		t.Errorf("worker: %v", err)
+	}
+	run := readResult(t, result)
+	if run.Metrics.Succeeded != 4 {
+		t.Errorf("aggregated %d succeeded txns, want 4", run.Metrics.Succeeded)
+	}
+	if v := summary(run, "Worker dead"); !strings.HasPrefix(v, "lost") {
+		t.Errorf("summary of the dead worker %q, want lost", v)
+	}
+}
+
+func TestFailedWorker(t *testing.T) {
+	// the coordinator must not wait for the heartbeat timeout
+	scenario := Scenario{Instances: 1, InitEther: units.NewAmountOf(1, units.Ether), Rounds: 2}
+	url, result, errc := startCoordinator(t, NewCoordinator(testPool(t), 2, scenario, 0, time.Second))
+	emptyKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	workerErrs := make(chan error, 2)
+	for name, key := range map[string]string{
+		"alive":  testChain.PrivateKey(),
+		"broken": hex.EncodeToString(crypto.FromECDSA(emptyKey)),
+	} {
+		pool := testPool(t)
+		go func(name string, key string) {
+			workerErrs <- RunWorker(context.Background(), url, name, pool, key)
+		}(name, key)
+	}
+	waitRun(t, errc, heartbeatTimeout/2)
+	failed := 0
+	for i := 0; i < 2; i++ {
+		if err := <-workerErrs; err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("%d workers failed, want 1", failed)
+	}
+	run := readResult(t, result)
+	if v := summary(run, "Worker broken"); !strings.Contains(v, "insufficient funds") {
+		t.Errorf("summary of the broken worker %q, want its funding error", v)
+	}
+	if v := summary(run, "Worker alive"); v != "" {
+		t.Errorf("summary of the alive worker %q, want none", v)
+	}
+}
+
+func TestUnknownWorker(t *testing.T) {
+	scenario := Scenario{Instances: 1, InitEther: units.NewAmountOf(1, units.Ether), Rounds: 1}
+	c := NewCoordinator(testPool(t), 1, scenario, 0, time.Second)
+	url, _, errc := startCoordinator(t, c)
+	ctx := context.Background()
+	client := &http.Client{}
+	if err := post(ctx, client, url+"/telemetry", Telemetry{Worker: "stranger"}, &TelemetryReply{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("telemetry of an unknown worker: %v, want 403", err)
+	}
+	if err := post(ctx, client, url+"/done", Done{Worker: "stranger"}, nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("done of an unknown worker: %v, want 403", err)
+	}
+	pool := testPool(t)
+	if err := RunWorker(ctx, url, "known", pool, testChain.PrivateKey()); err != nil {
+		t.Errorf("worker: %v", err)
+	}
+	waitRun(t, errc, time.Minute)
+}
+
+// summary is the value of the summary line name of run, empty when missing.
+func summary(run *report.Run, name string) string {
+	for _, f := range run.Summary {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,298 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/testUtils"
+)
+
+// doneTimeout is how long the coordinator waits for the workers to report
+// done once the run stopped.
+var doneTimeout = time.Minute * 2
+
+// heartbeatTimeout is how long a running worker may go without sending
+// telemetry before it is given up as lost, workers send it every
+// flushInterval.
+var heartbeatTimeout = time.Second * 30
+
+// Coordinator hands out the shards of a test to workers and aggregates their
+// events into one run.
+type Coordinator struct {
+	pool        *api.ClientPool
+	workers     int
+	scenario    Scenario
+	errorBudget int64
+	startDelay  time.Duration
+
+	mu       sync.Mutex
+	names    []string
+	startAt  time.Time
+	assigned chan struct{} // closed once every worker registered
+	remote   *testUtils.RemoteRun
+	started  chan struct{} // closed once remote is set
+	lastSeen map[string]time.Time
+	done     map[string]bool
+	failed   map[string]string // why a worker failed or was lost
+
+	allDone  chan struct{}
+	finished bool
+}
+
+// NewCoordinator runs scenario on workers processes, which start startDelay
+// after the last of them registered. errorBudget is over all workers.
+func NewCoordinator(pool *api.ClientPool, workers int, scenario Scenario, errorBudget int64, startDelay time.Duration) *Coordinator {
+	return &Coordinator{
+		pool:        pool,
+		workers:     workers,
+		scenario:    scenario,
+		errorBudget: errorBudget,
+		startDelay:  startDelay,
+		assigned:    make(chan struct{}),
+		started:     make(chan struct{}),
+		lastSeen:    map[string]time.Time{},
+		done:        map[string]bool{},
+		failed:      map[string]string{},
+		allDone:     make(chan struct{}),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (c *Coordinator) register(w http.ResponseWriter, r *http.Request) {
+	var req Register
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Worker == "" {
+		http.Error(w, "bad register request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	if len(c.names) >= c.workers {
+		c.mu.Unlock()
+		http.Error(w, "every worker is already registered", http.StatusConflict)
+		return
+	}
+	for _, name := range c.names {
+		if name == req.Worker {
+			c.mu.Unlock()
+			http.Error(w, "worker "+name+" is already registered", http.StatusConflict)
+			return
+		}
+	}
+	index := len(c.names)
+	c.names = append(c.names, req.Worker)
+	log.Infof("Worker %s registered (%d/%d)", req.Worker, len(c.names), c.workers)
+	if len(c.names) == c.workers {
+		c.startAt = time.Now().Add(c.startDelay)
+		close(c.assigned)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.assigned:
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, Assignment{
+		Scenario:      c.scenario,
+		FirstInstance: index * c.scenario.Instances,
+		StartAt:       c.startAt,
+		Now:           time.Now(),
+	})
+}
+
+// registered tells whether worker registered, c.mu must be held.
+func (c *Coordinator) registered(worker string) bool {
+	for _, name := range c.names {
+		if name == worker {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Coordinator) telemetry(w http.ResponseWriter, r *http.Request) {
+	var req Telemetry
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad telemetry request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	known := c.registered(req.Worker)
+	c.mu.Unlock()
+	if !known {
+		http.Error(w, "worker "+req.Worker+" is not registered", http.StatusForbidden)
+		return
+	}
+	if len(req.Events) == 0 {
+		// a heartbeat of a worker still funding its accounts
+		select {
+		case <-c.started:
+		default:
+			writeJSON(w, TelemetryReply{})
+			return
+		}
+	}
+	select {
+	case <-c.started:
+	case <-r.Context().Done():
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished {
+		http.Error(w, "the run is finished", http.StatusGone)
+		return
+	}
+	c.lastSeen[req.Worker] = time.Now()
+	for _, raw := range req.Events {
+		e, err := testUtils.UnmarshalEvent(raw)
+		if err != nil {
+			log.Warnf("bad event from worker %s: %v", req.Worker, err)
+			continue
+		}
+		c.remote.Emit(e)
+	}
+	var reply TelemetryReply
+	if ctrl := c.remote.Controller(); ctrl.Context().Err() != nil {
+		reply.Stop = true
+		reply.Reason = ctrl.StopReason()
+	}
+	writeJSON(w, reply)
+}
+
+func (c *Coordinator) workerDone(w http.ResponseWriter, r *http.Request) {
+	var req Done
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad done request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.registered(req.Worker) {
+		http.Error(w, "worker "+req.Worker+" is not registered", http.StatusForbidden)
+		return
+	}
+	if req.Err != "" {
+		log.Warnf("Worker %s done with error: %s", req.Worker, req.Err)
+		c.failed[req.Worker] = "failed: " + req.Err
+	} else {
+		log.Infof("Worker %s done", req.Worker)
+	}
+	c.markDone(req.Worker)
+}
+
+// markDone counts worker as done, c.mu must be held.
+func (c *Coordinator) markDone(worker string) {
+	if c.done[worker] {
+		return
+	}
+	c.done[worker] = true
+	if len(c.done) == c.workers {
+		close(c.allDone)
+	}
+}
+
+// watchHeartbeats gives up the running workers which sent no telemetry for
+// heartbeatTimeout, so that a dead worker does not hold the run forever.
+func (c *Coordinator) watchHeartbeats() {
+	ticker := time.NewTicker(heartbeatTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.allDone:
+			return
+		}
+		c.mu.Lock()
+		for _, name := range c.names {
+			if c.done[name] {
+				continue
+			}
+			if silent := time.Since(c.lastSeen[name]); silent > heartbeatTimeout {
+				log.Warnf("Worker %s lost, no telemetry for %s, finish without it", name, silent.Round(time.Second))
+				c.failed[name] = fmt.Sprintf("lost, no telemetry for %s", silent.Round(time.Second))
+				c.markDone(name)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Run serves the workers at addr until every one of them is done or lost, or
+// doneTimeout after the run stopped, and returns the error of the SLOs that
+// failed.
+func (c *Coordinator) Run(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return c.Serve(ctx, listener)
+}
+
+// Serve is Run on listener, which it closes.
+func (c *Coordinator) Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.register)
+	mux.HandleFunc("/telemetry", c.telemetry)
+	mux.HandleFunc("/done", c.workerDone)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+	log.Infof("Coordinator listening at http://%s, waiting for %d workers", listener.Addr(), c.workers)
+
+	select {
+	case <-c.assigned:
+	case <-ctx.Done():
+		return fmt.Errorf("interrupted while waiting for workers")
+	}
+	select {
+	case <-time.After(time.Until(c.startAt)):
+	case <-ctx.Done():
+		return fmt.Errorf("interrupted before the start")
+	}
+	cond := testUtils.StopConditions{Duration: c.scenario.Duration, ErrorBudget: c.errorBudget}
+	remote, err := testUtils.NewRemoteRun(ctx, c.pool, "Distributed transfer load test", cond)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.remote = remote
+	for _, name := range c.names {
+		c.lastSeen[name] = time.Now()
+	}
+	c.mu.Unlock()
+	close(c.started)
+	go c.watchHeartbeats()
+
+	select {
+	case <-c.allDone:
+	case <-remote.Controller().Done():
+		select {
+		case <-c.allDone:
+		case <-time.After(doneTimeout):
+			log.Warnf("Not every worker is done %s after the stop, finish without them", doneTimeout)
+		}
+	}
+	c.mu.Lock()
+	c.finished = true
+	for _, name := range c.names {
+		switch {
+		case c.failed[name] != "":
+			remote.AddSummary("Worker "+name, c.failed[name])
+		case !c.done[name]:
+			remote.AddSummary("Worker "+name, "not done")
+		}
+	}
+	c.mu.Unlock()
+	return remote.Finish()
+}
@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/KSlashh/test-eth/units"
+)
+
+// The coordinator serves, all as json POST:
+//
+//	/register   Register  --> Assignment, answered once every worker registered
+//	/telemetry  Telemetry --> TelemetryReply, sent by workers every flushInterval
+//	                          from the assignment on, empty ones as heartbeats
+//	/done       Done      --> nothing, sent by workers once their shard ended or
+//	                          failed
+//
+// Requests of workers which did not register are refused with 403.
+
+// Scenario is the test every worker runs on its shard of instances.
+type Scenario struct {
+	Instances int           // per worker
+	InitEther *units.Amount // funded to every account
+	Duration  time.Duration
+	TotalTxns int64 // per worker
+	Rounds    int
+}
+
+type Register struct {
+	Worker string
+}
+
+// Assignment is the shard of a worker, it starts at StartAt of the
+// coordinator clock, Now being the coordinator time when it was sent.
+type Assignment struct {
+	Scenario      Scenario
+	FirstInstance int
+	StartAt       time.Time
+	Now           time.Time
+}
+
+// Telemetry carries events encoded by testUtils.MarshalEvent.
+type Telemetry struct {
+	Worker string
+	Events []json.RawMessage
+}
+
+// TelemetryReply tells the worker to stop sending when the coordinator run
+// stopped.
+type TelemetryReply struct {
+	Stop   bool
+	Reason string
+}
+
+// Done tells that the shard of Worker ended, Err is why it ended early, empty
+// when it ran its whole scenario.
+type Done struct {
+	Worker string
+	Err    string
+}
+
+// post sends req as json to url and decodes the answer into reply, which may
+// be nil.
+func post(ctx context.Context, client *http.Client, url string, req interface{}, reply interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
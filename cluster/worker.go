@@ -0,0 +1,205 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/testUtils"
+)
+
+var flushInterval = time.Second * 1
+var requestTimeout = time.Second * 10
+var registerRetryInterval = time.Second * 2
+var finalFlushAttempts = 3
+
+// RunWorker registers at the coordinator, funds the accounts of its shard, runs
+// it at the assigned start time and streams the events of the shard back. Once
+// registered it reports done to the coordinator, with the error which ended
+// the shard if any.
+func RunWorker(ctx context.Context, coordinator string, name string, pool *api.ClientPool, privateKeyHex string) error {
+	coordinator = strings.TrimSuffix(coordinator, "/")
+	client := &http.Client{}
+	var a Assignment
+	for {
+		// the answer only comes once every worker registered
+		err := post(ctx, client, coordinator+"/register", Register{Worker: name}, &a)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warnf("register at %s fail: %v, retry in %s", coordinator, err, registerRetryInterval)
+		select {
+		case <-time.After(registerRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	err := runAssignment(ctx, client, coordinator, name, pool, privateKeyHex, a)
+	done := Done{Worker: name}
+	if err != nil {
+		done.Err = err.Error()
+	}
+	doneCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if doneErr := post(doneCtx, client, coordinator+"/done", done, nil); err == nil {
+		err = doneErr
+	}
+	return err
+}
+
+// runAssignment funds the accounts of the shard of a and runs it at the
+// assigned start time.
+func runAssignment(ctx context.Context, client *http.Client, coordinator string, name string, pool *api.ClientPool, privateKeyHex string, a Assignment) error {
+	// the start time is on the coordinator clock, correct it by the clock
+	// difference seen when the assignment arrived
+	skew := a.Now.Sub(time.Now())
+	startAt := a.StartAt.Add(-skew)
+	log.Infof("Assigned instances %d to %d, start in %s", a.FirstInstance, a.FirstInstance+a.Scenario.Instances-1, time.Until(startAt).Round(time.Millisecond))
+	// the accounts are funded before the start, so that the funding does
+	// not use up the duration of the run
+	funded := make(chan struct{})
+	go heartbeat(client, coordinator, name, funded)
+	shard, err := testUtils.FundShard(ctx, pool, privateKeyHex, a.Scenario.InitEther, a.FirstInstance, a.Scenario.Instances)
+	close(funded)
+	if err != nil {
+		return fmt.Errorf("fund shard: %v", err)
+	}
+	wait := time.Until(startAt)
+	if wait < 0 {
+		log.Warnf("Funding ended %s after the start, raise -start-delay of the coordinator", (-wait).Round(time.Millisecond))
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	cond := testUtils.StopConditions{
+		Duration:  a.Scenario.Duration,
+		TotalTxns: a.Scenario.TotalTxns,
+		Rounds:    a.Scenario.Rounds,
+	}
+	ctrl := testUtils.NewRunController(ctx, cond)
+	sink := newTelemetrySink(client, coordinator, name, ctrl)
+	testUtils.RunShard(ctrl, pool, shard, sink)
+	// an interrupted shard did not run its whole scenario
+	return ctx.Err()
+}
+
+// heartbeat sends empty telemetry every flushInterval until stop is closed, so
+// that the coordinator does not give up a worker which is late funding its
+// accounts.
+func heartbeat(client *http.Client, coordinator string, worker string, stop chan struct{}) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			post(ctx, client, coordinator+"/telemetry", Telemetry{Worker: worker}, nil)
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// telemetrySink sends the events to the coordinator every flushInterval, and
+// stops the run when the coordinator tells so.
+type telemetrySink struct {
+	client *http.Client
+	url    string
+	worker string
+	ctrl   *testUtils.RunController
+
+	mu      sync.Mutex
+	pending []json.RawMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTelemetrySink(client *http.Client, coordinator string, worker string, ctrl *testUtils.RunController) *telemetrySink {
+	s := &telemetrySink{
+		client: client,
+		url:    coordinator + "/telemetry",
+		worker: worker,
+		ctrl:   ctrl,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *telemetrySink) Handle(e testUtils.Event) {
+	data, err := testUtils.MarshalEvent(e)
+	if err != nil {
+		log.Errorf("encode event fail: %v", err)
+		return
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, data)
+	s.mu.Unlock()
+}
+
+func (s *telemetrySink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Warnf("send telemetry fail: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// flush sends the pending events, they are kept for the next flush when the
+// coordinator can not be reached.
+func (s *telemetrySink) flush() error {
+	s.mu.Lock()
+	events := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	var reply TelemetryReply
+	if err := post(ctx, s.client, s.url, Telemetry{Worker: s.worker, Events: events}, &reply); err != nil {
+		s.mu.Lock()
+		s.pending = append(events, s.pending...)
+		s.mu.Unlock()
+		return err
+	}
+	if reply.Stop {
+		s.ctrl.Stop("stopped by coordinator: " + reply.Reason)
+	}
+	return nil
+}
+
+func (s *telemetrySink) Close() {
+	close(s.stop)
+	<-s.done
+	var err error
+	for i := 0; i < finalFlushAttempts; i++ {
+		if err = s.flush(); err == nil {
+			return
+		}
+		time.Sleep(registerRetryInterval)
+	}
+	log.Errorf("send the last telemetry fail, %d events lost: %v", len(s.pending), err)
+}
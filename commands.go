@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/cluster"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/KSlashh/test-eth/testUtils"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+func init() {
+	register(&command{
+		group:   "bench",
+		name:    "transfer",
+		summary: "transfer ether back and forth between pairs of accounts, waiting for every tx; 0 limits are no limit, the test stops at the first limit reached",
+		flags:   benchTransfer,
+	})
+	register(&command{
+		group:   "bench",
+		name:    "pipeline",
+		summary: "send pre-signed transfers from pairs of accounts without waiting for receipts, until interrupted",
+		flags:   benchPipeline,
+	})
+	register(&command{
+		group:   "bench",
+		name:    "campaign",
+		summary: "run the phases of the profile one after the other, e.g. funding, warmup, measure, cooldown and drain; only the measured phases count toward the metrics",
+		flags:   benchCampaign,
+	})
+	register(&command{
+		group:   "bench",
+		name:    "record",
+		summary: "record per-block throughput from a height on, until interrupted",
+		flags:   benchRecord,
+	})
+	register(&command{
+		group:   "bench",
+		name:    "compare",
+		summary: "compare the result files of runs with the first one, exit with status 1 when a regression threshold is breached",
+		args:    "<baseline result> <result>...",
+		flags:   benchCompare,
+	})
+	register(&command{
+		group:   "cluster",
+		name:    "coordinate",
+		summary: "run a transfer load test on several worker processes, aggregating their telemetry into one report",
+		flags:   clusterCoordinate,
+	})
+	register(&command{
+		group:   "cluster",
+		name:    "worker",
+		summary: "run the shard of a load test assigned by a coordinator",
+		flags:   clusterWorker,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "header",
+		summary: "print a block header",
+		flags:   chainHeader,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "block",
+		summary: "print a decoded block",
+		flags:   chainBlock,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "tx",
+		summary: "print a decoded transaction",
+		flags:   chainTx,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "receipt",
+		summary: "print a decoded receipt, with logs decoded by -abi",
+		flags:   chainReceipt,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "txcount",
+		summary: "print the number of txns of a block",
+		flags:   chainTxCount,
+	})
+	register(&command{
+		group:   "chain",
+		name:    "validators",
+		summary: "report proposers, round changes and seal participation of Zion validators over a block range",
+		flags:   chainValidators,
+	})
+	register(&command{
+		group:   "account",
+		name:    "balance",
+		summary: "print the balance of an address",
+		flags:   accountBalance,
+	})
+	register(&command{
+		group:   "account",
+		name:    "transfer",
+		summary: "transfer ether from the configured private key",
+		flags:   accountTransfer,
+	})
+}
+
+func benchTransfer(fs *flag.FlagSet) func(ctx context.Context) error {
+	instances := fs.Int("instances", 0, "number of account pairs sending txns (required)")
+	stop := stopFlag(fs)
+	initEther := amountFlag(fs, "init", units.NewAmountOf(1, units.Ether), units.Ether, "`amount` funded to every account")
+	reports := reportFlag(fs)
+	return func(ctx context.Context) error {
+		if *instances <= 0 {
+			return usageErrorf("-instances must be positive")
+		}
+		cond, err := stop.conditions()
+		if err != nil {
+			return err
+		}
+		e, err := connectSigner(ctx)
+		if err != nil {
+			return err
+		}
+		enableReport(reports, e, fs)
+		return testUtils.TestServer(ctx, *instances, e.pool, e.conf.PrivateKey, *initEther, cond)
+	}
+}
+
+func benchPipeline(fs *flag.FlagSet) func(ctx context.Context) error {
+	instances := fs.Int("instances", 1, "number of account pairs sending txns")
+	stop := stopFlag(fs)
+	initEther := amountFlag(fs, "init", units.NewAmountOf(10, units.Ether), units.Ether, "`amount` funded to every account")
+	reports := reportFlag(fs)
+	return func(ctx context.Context) error {
+		if *instances <= 0 {
+			return usageErrorf("-instances must be positive")
+		}
+		cond, err := stop.conditions()
+		if err != nil {
+			return err
+		}
+		e, err := connectSigner(ctx)
+		if err != nil {
+			return err
+		}
+		enableReport(reports, e, fs)
+		return testUtils.TestServer2(ctx, *instances, e.pool, e.conf.PrivateKey, *initEther, cond)
+	}
+}
+
+func benchCampaign(fs *flag.FlagSet) func(ctx context.Context) error {
+	initEther := amountFlag(fs, "init", units.NewAmountOf(1, units.Ether), units.Ether, "`amount` funded to every account")
+	reports := reportFlag(fs)
+	return func(ctx context.Context) error {
+		e, err := connectSigner(ctx)
+		if err != nil {
+			return err
+		}
+		if len(e.conf.Phases) == 0 {
+			return fmt.Errorf("no Phases in profile %q of %s", e.conf.ProfileName, confFile)
+		}
+		enableReport(reports, e, fs)
+		return testUtils.RunCampaign(ctx, e.pool, e.conf.PrivateKey, *initEther, e.conf.Phases)
+	}
+}
+
+func benchRecord(fs *flag.FlagSet) func(ctx context.Context) error {
+	start := fs.Uint64("start", 1, "first block to record")
+	reports := reportFlag(fs)
+	return func(ctx context.Context) error {
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		enableReport(reports, e, fs)
+		var monitor *testUtils.TxpoolMonitor
+		if e.txpoolInterval > 0 {
+			monitor = testUtils.NewTxpoolMonitor(e.pool.Endpoints()[0].Rpc, false)
+			monitor.Start(ctx, e.txpoolInterval)
+			defer monitor.Close()
+		}
+		testUtils.Recorder2(ctx, e.client, new(big.Int).SetUint64(*start), monitor)
+		return nil
+	}
+}
+
+func benchCompare(fs *flag.FlagSet) func(ctx context.Context) error {
+	tpsDrop := fs.Float64("max-tps-drop", 5, "tps drop from the baseline tolerated, in `percent`, negative to disable")
+	latencyIncrease := fs.Float64("max-latency-increase", 10, "p50, p90 and p99 latency increase from the baseline tolerated, in `percent`, negative to disable")
+	failureIncrease := fs.Float64("max-failure-rate-increase", 1, "failure rate increase from the baseline tolerated, in percentage `points`, negative to disable")
+	return func(ctx context.Context) error {
+		files := fs.Args()
+		if len(files) < 2 {
+			return usageErrorf("need a baseline and at least one result file")
+		}
+		var runs []*report.Run
+		for _, f := range files {
+			run, err := report.ReadJSONFile(f)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+		c := report.Compare(files, runs, report.Thresholds{
+			TpsDrop:             *tpsDrop,
+			LatencyIncrease:     *latencyIncrease,
+			FailureRateIncrease: *failureIncrease,
+		})
+		if err := printResult(c, func() { fmt.Print(c) }); err != nil {
+			return err
+		}
+		if len(c.Regressions) > 0 {
+			return fmt.Errorf("%d regression(s) against %s", len(c.Regressions), files[0])
+		}
+		return nil
+	}
+}
+
+func clusterCoordinate(fs *flag.FlagSet) func(ctx context.Context) error {
+	listen := fs.String("listen", "127.0.0.1:9300", "`address` the workers connect to")
+	workers := fs.Int("workers", 0, "number of workers to wait for (required)")
+	instances := fs.Int("instances", 1, "number of account pairs sending txns on every worker")
+	duration := fs.Duration("duration", 0, "stop after this duration, e.g. 10m")
+	txns := fs.Int64("txns", 0, "stop after this many txns are sent, split between the workers")
+	rounds := fs.Int("rounds", 0, "stop after every instance did this many rounds")
+	errorBudget := fs.Int64("error-budget", 0, "stop after this many failed txns over all workers")
+	initEther := amountFlag(fs, "init", units.NewAmountOf(1, units.Ether), units.Ether, "`amount` funded to every account")
+	startDelay := fs.Duration("start-delay", time.Second*30, "start the workers this long after the last one registered, they fund their accounts meanwhile")
+	reports := reportFlag(fs)
+	return func(ctx context.Context) error {
+		if *workers <= 0 || *instances <= 0 {
+			return usageErrorf("-workers and -instances must be positive")
+		}
+		if *duration < 0 || *txns < 0 || *rounds < 0 || *errorBudget < 0 || *startDelay < 0 {
+			return usageErrorf("-duration, -txns, -rounds, -error-budget and -start-delay must not be negative")
+		}
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		enableReport(reports, e, fs)
+		scenario := cluster.Scenario{
+			Instances: *instances,
+			InitEther: *initEther,
+			Duration:  *duration,
+			TotalTxns: (*txns + int64(*workers) - 1) / int64(*workers),
+			Rounds:    *rounds,
+		}
+		return cluster.NewCoordinator(e.pool, *workers, scenario, *errorBudget, *startDelay).Run(ctx, *listen)
+	}
+}
+
+func clusterWorker(fs *flag.FlagSet) func(ctx context.Context) error {
+	coordinator := fs.String("coordinator", "", "`url` of the coordinator, e.g. http://10.0.0.1:9300 (required)")
+	hostname, _ := os.Hostname()
+	name := fs.String("name", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "unique `name` of the worker")
+	return func(ctx context.Context) error {
+		if *coordinator == "" || *name == "" {
+			return usageErrorf("-coordinator and -name must be set")
+		}
+		e, err := connectSigner(ctx)
+		if err != nil {
+			return err
+		}
+		return cluster.RunWorker(ctx, *coordinator, *name, e.pool, e.conf.PrivateKey)
+	}
+}
+
+// stopFlags are the -duration, -txns, -rounds and -error-budget flags of the
+// bench commands, a run without any of them stops on SIGINT only.
+type stopFlags struct {
+	duration    *time.Duration
+	txns        *int64
+	rounds      *int
+	errorBudget *int64
+}
+
+func stopFlag(fs *flag.FlagSet) stopFlags {
+	return stopFlags{
+		duration:    fs.Duration("duration", 0, "stop after this duration, e.g. 10m"),
+		txns:        fs.Int64("txns", 0, "stop after this many txns are sent"),
+		rounds:      fs.Int("rounds", 0, "stop after every instance did this many rounds"),
+		errorBudget: fs.Int64("error-budget", 0, "stop after this many failed txns"),
+	}
+}
+
+func (f stopFlags) conditions() (testUtils.StopConditions, error) {
+	if *f.duration < 0 || *f.txns < 0 || *f.rounds < 0 || *f.errorBudget < 0 {
+		return testUtils.StopConditions{}, usageErrorf("-duration, -txns, -rounds and -error-budget must not be negative")
+	}
+	return testUtils.StopConditions{
+		Duration:    *f.duration,
+		TotalTxns:   *f.txns,
+		Rounds:      *f.rounds,
+		ErrorBudget: *f.errorBudget,
+	}, nil
+}
+
+// reportFlags are the -report and -result flags of the bench commands.
+type reportFlags struct {
+	html   *string
+	result *string
+}
+
+func reportFlag(fs *flag.FlagSet) reportFlags {
+	return reportFlags{
+		html:   fs.String("report", "", "write a self-contained html report of the run to this `file` when it ends"),
+		result: fs.String("result", "", "save the data of the run to this json `file` when it ends, for bench compare"),
+	}
+}
+
+// enableReport makes the run write its report and result files, with the
+// network, the profile and the flags of the command as configuration table.
+func enableReport(files reportFlags, e *env, fs *flag.FlagSet) {
+	if *files.html == "" && *files.result == "" {
+		return
+	}
+	conf := e.conf
+	var urls []string
+	for _, ep := range conf.Endpoints() {
+		urls = append(urls, ep.Url)
+	}
+	settings := []report.Field{
+		{Name: "Command", Value: fs.Name()},
+		{Name: "Network", Value: conf.NetworkName},
+		{Name: "Nodes", Value: strings.Join(urls, ", ")},
+		{Name: "Load balance", Value: conf.LoadBalance},
+		{Name: "Chain id", Value: fmt.Sprint(conf.ChainID)},
+		{Name: "Signer", Value: conf.Signer},
+		{Name: "Gas price", Value: conf.GasPrice.String()},
+		{Name: "Gas limit", Value: fmt.Sprint(conf.GasLimit)},
+		{Name: "Batch size", Value: fmt.Sprint(conf.BatchSize)},
+		{Name: "Profile", Value: conf.ProfileName},
+		{Name: "Tx amount", Value: conf.TxAmount.String()},
+		{Name: "Confirm poll interval", Value: fmt.Sprintf("%d ms", conf.ConfirmPollInterval)},
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "report" && f.Name != "result" {
+			settings = append(settings, report.Field{Name: "-" + f.Name, Value: f.Value.String()})
+		}
+	})
+	testUtils.EnableReport(*files.html, *files.result, settings)
+}
+
+func chainHeader(fs *flag.FlagSet) func(ctx context.Context) error {
+	height := heightFlag(fs, "height", "block `number`")
+	return func(ctx context.Context) error {
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		header, err := e.client.HeaderByNumber(ctx, height.height)
+		if err != nil {
+			return fmt.Errorf("GetHeader fail: %v", err)
+		}
+		return printResult(header, func() { log.Info(header) })
+	}
+}
+
+func chainBlock(fs *flag.FlagSet) func(ctx context.Context) error {
+	height := heightFlag(fs, "height", "block `number`")
+	return func(ctx context.Context) error {
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		view, err := api.GetBlockView(ctx, e.client, height.height)
+		if err != nil {
+			return fmt.Errorf("GetBlock fail: %v", err)
+		}
+		return printView(view)
+	}
+}
+
+func chainTx(fs *flag.FlagSet) func(ctx context.Context) error {
+	hash := hashFlag(fs, "hash", "transaction `hash` (required)")
+	return func(ctx context.Context) error {
+		if !hash.set {
+			return usageErrorf("-hash is required")
+		}
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		view, err := api.GetTxView(ctx, e.client, *hash.hash)
+		if err != nil {
+			return fmt.Errorf("GetTx fail: %v", err)
+		}
+		return printView(view)
+	}
+}
+
+func chainReceipt(fs *flag.FlagSet) func(ctx context.Context) error {
+	hash := hashFlag(fs, "hash", "transaction `hash` (required)")
+	abiFile := fs.String("abi", "", "contract abi `file` used to decode logs")
+	return func(ctx context.Context) error {
+		if !hash.set {
+			return usageErrorf("-hash is required")
+		}
+		var contractAbi *abi.ABI
+		if *abiFile != "" {
+			var err error
+			contractAbi, err = api.LoadABI(*abiFile)
+			if err != nil {
+				return usageErrorf("LoadABI fail: %v", err)
+			}
+		}
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		view, err := api.GetReceiptView(ctx, e.client, *hash.hash, contractAbi)
+		if err != nil {
+			return fmt.Errorf("GetReceipt fail: %v", err)
+		}
+		return printView(view)
+	}
+}
+
+func chainTxCount(fs *flag.FlagSet) func(ctx context.Context) error {
+	height := heightFlag(fs, "height", "block `number`")
+	return func(ctx context.Context) error {
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		header, err := e.client.HeaderByNumber(ctx, height.height)
+		if err != nil {
+			return fmt.Errorf("get header fail: %v", err)
+		}
+		count, err := e.client.TransactionCount(ctx, header.Hash())
+		if err != nil {
+			return err
+		}
+		res := &txCountResult{BlockNumber: header.Number.Uint64(), BlockHash: header.Hash(), TxCount: count}
+		return printResult(res, func() {
+			log.Infof("for block %s at height %s , txns count %d", header.Hash(), header.Number.String(), count)
+		})
+	}
+}
+
+func chainValidators(fs *flag.FlagSet) func(ctx context.Context) error {
+	start := fs.Uint64("start", 0, "first block of the report (required)")
+	end := heightFlag(fs, "end", "last `block` of the report")
+	return func(ctx context.Context) error {
+		if *start == 0 {
+			return usageErrorf("-start is required")
+		}
+		if end.height != nil && end.height.Uint64() < *start {
+			return usageErrorf("-end must not be below -start")
+		}
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		var endHeight uint64
+		if end.height != nil {
+			endHeight = end.height.Uint64()
+		} else if endHeight, err = e.client.BlockNumber(ctx); err != nil {
+			return fmt.Errorf("get block number fail: %v", err)
+		}
+		stats, err := testUtils.ValidatorReport(ctx, e.client, *start, endHeight)
+		if err != nil {
+			return fmt.Errorf("ValidatorReport fail: %v", err)
+		}
+		return printResult(newValidatorsResult(stats, *start, endHeight), stats.Report)
+	}
+}
+
+func accountBalance(fs *flag.FlagSet) func(ctx context.Context) error {
+	address := addressFlag(fs, "address", "account `address` (required)")
+	height := heightFlag(fs, "height", "block `number`")
+	return func(ctx context.Context) error {
+		if !address.set {
+			return usageErrorf("-address is required")
+		}
+		e, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		res := &balanceResult{Address: *address.address}
+		if height.height == nil {
+			res.Balance, err = api.GetBalance(ctx, e.client, address.address.Hex())
+		} else {
+			number := height.height.Uint64()
+			res.BlockNumber = &number
+			res.Balance, err = api.GetBalanceAt(ctx, e.client, address.address.Hex(), height.height.Int64())
+		}
+		if err != nil {
+			return fmt.Errorf("GetBalance fail: %v", err)
+		}
+		res.Ether = res.Balance.In(units.Ether)
+		return printResult(res, func() {
+			if res.BlockNumber == nil {
+				log.Infof("balance of %s is %s", address.address.Hex(), res.Balance)
+			} else {
+				log.Infof("balance of %s at height %d is %s", address.address.Hex(), *res.BlockNumber, res.Balance)
+			}
+		})
+	}
+}
+
+func accountTransfer(fs *flag.FlagSet) func(ctx context.Context) error {
+	to := addressFlag(fs, "to", "recipient `address` (required)")
+	amount := amountFlag(fs, "amount", nil, units.Wei, "`amount` to transfer (required)")
+	return func(ctx context.Context) error {
+		if !to.set {
+			return usageErrorf("-to is required")
+		}
+		if *amount == nil {
+			return usageErrorf("-amount is required")
+		}
+		e, err := connectSigner(ctx)
+		if err != nil {
+			return err
+		}
+		hash, err := api.TransferEth(ctx, e.client, e.conf.PrivateKey, to.address.Hex(), *amount)
+		if err != nil {
+			return fmt.Errorf("TransferEther fail: %v", err)
+		}
+		res := &transferResult{TxHash: hash, To: *to.address, Amount: *amount}
+		return printResult(res, func() {
+			log.Infof("Success! Transfer %s at Tx %x .", *amount, hash)
+		})
+	}
+}
@@ -2,13 +2,127 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/units"
 )
 
+// EnvPrefix is the prefix of the environment variables overriding the
+// configuration file, see applyEnv.
+const EnvPrefix = "TEST_ETH_"
+
+// Endpoint is one rpc node, Weight is only used by the weighted load balance.
+type Endpoint struct {
+	Url    string
+	Weight int
+}
+
+// Network is one chain to test against.
+type Network struct {
+	Node       string
+	PrivateKey string // key of the account funding the test accounts
+
+	// Nodes overrides Node when set, sends are spread across them
+	Nodes       []Endpoint
+	LoadBalance string // round-robin(default), weighted or sticky
+
+	ChainID  uint64        // checked against the nodes, 0 to accept any chain
+	Signer   string        // latest(default), london, berlin, eip155 or homestead
+	GasPrice *units.Amount // of every test tx, default 1gwei
+	GasLimit uint64        // of every transfer, default 21000
+}
+
+// Profile is a named set of test defaults.
+type Profile struct {
+	RecordFrequency          float64       // second
+	TotalDataRecordFrequency float64       // second
+	ConfirmPollInterval      int           // millisecond
+	TxAmount                 *units.Amount // of every test transfer
+	ShutdownGracePeriod      int           // millisecond
+	TpsWindowBlocks          int
+	BlockSummaryFrequency    int // blocks
+
+	TargetTps float64 // expected tps, the target of "tps >= 95% target"
+	SLOs      []SLO   // checked during and at the end of load tests
+	FailFast  bool    // stop a load test as soon as a hard SLO is violated
+
+	Phases []Phase // the campaign run by bench campaign
+}
+
+// SLO is one assertion on a load test, e.g. "latency_p99 < 3s", see
+// testUtils.ParseSLO.
+type SLO struct {
+	Check string
+	Hard  bool // stops the test when violated and FailFast is set
+}
+
+// Phase is one step of a load test campaign, e.g. funding, warmup, measure,
+// cooldown and drain, see testUtils.RunCampaign. The phase ends at the first
+// of its limits, 0 is no limit.
+type Phase struct {
+	Name      string
+	Workload  string // "fund", "transfer" or "idle"
+	Instances int    // account pairs sending txns in a transfer phase
+	Duration  int    // second
+	Txns      int64  // txns sent in the phase
+	Rounds    int    // rounds per instance
+	Measure   bool   // count toward the metrics of the report and the SLOs
+}
+
 // Config ...
+//
+// The Network and Profile fields at the top level are used when no named
+// network or profile is selected, so single-network files keep working.
 type Config struct {
-	Node       string
-	PrivateKey string
+	Network
+	Profile
+
+	DefaultNetwork string
+	Networks       map[string]*Network
+	DefaultProfile string
+	Profiles       map[string]*Profile
+
+	// json-rpc batching, disabled when BatchSize is 0
+	BatchSize          int
+	BatchFlushInterval int // millisecond
+
+	// address of the prometheus metrics endpoint, e.g. "127.0.0.1:9100", empty to disable
+	MetricsAddr string
+
+	// file to write every load-test event to as json lines, empty to disable
+	EventsFile string
+
+	// poll the txpool every TxpoolMonitorInterval millisecond, 0 to disable
+	TxpoolMonitorInterval int
+
+	// directory to also write the logs to, empty to disable. A new file is
+	// started every LogMaxSize MB and every LogMaxAge hours, 0 for no limit,
+	// and only the last LogMaxBackups files are kept, 0 to keep all.
+	LogDir        string
+	LogMaxSize    int // MB
+	LogMaxAge     int // hour
+	LogMaxBackups int
+	LogCompress   bool // gzip rotated files
+
+	// level of each log module, e.g. {"rpc": "debug", "instance": "warn"},
+	// a group name like "instance" covers instance-0, instance-1... and
+	// "default" is the level of everything else. Reloaded on SIGHUP.
+	LogLevels map[string]string
+
+	// address of the admin endpoint changing log levels at runtime, e.g.
+	// "127.0.0.1:9101", empty to disable
+	AdminAddr string
+
+	// names of the selected network and profile, empty for the top level ones
+	NetworkName string `json:"-"`
+	ProfileName string `json:"-"`
 }
 
 // LoadConfig ...
@@ -22,3 +136,304 @@ func LoadConfig(confFile string) (config *Config, err error) {
 	err = json.Unmarshal(jsonBytes, config)
 	return
 }
+
+// Load reads confFile, selects the network and profile, applies environment
+// overrides and defaults, and validates the result. Empty network or profile
+// select the one named by TEST_ETH_NETWORK / TEST_ETH_PROFILE, then the
+// DefaultNetwork / DefaultProfile of the file.
+func Load(confFile string, network string, profile string) (*Config, error) {
+	c, err := LoadConfig(confFile)
+	if err != nil {
+		return nil, err
+	}
+	if network == "" {
+		network = firstNonEmpty(os.Getenv(EnvPrefix+"NETWORK"), c.DefaultNetwork)
+	}
+	if profile == "" {
+		profile = firstNonEmpty(os.Getenv(EnvPrefix+"PROFILE"), c.DefaultProfile)
+	}
+	if err := c.selectNetwork(network); err != nil {
+		return nil, err
+	}
+	if err := c.selectProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+	c.Network.setDefaults()
+	c.Profile.setDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", confFile, err)
+	}
+	return c, nil
+}
+
+// LoadLocal is Load for a chain the tool runs itself: confFile is optional,
+// and its networks are replaced by local, the node of that chain.
+func LoadLocal(confFile string, profile string, local Network) (*Config, error) {
+	c := &Config{}
+	if _, err := os.Stat(confFile); err == nil {
+		if c, err = LoadConfig(confFile); err != nil {
+			return nil, err
+		}
+	}
+	if profile == "" {
+		profile = firstNonEmpty(os.Getenv(EnvPrefix+"PROFILE"), c.DefaultProfile)
+	}
+	if err := c.selectProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+	c.Network = local
+	c.NetworkName = "local"
+	c.Network.setDefaults()
+	c.Profile.setDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", confFile, err)
+	}
+	return c, nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func names(m interface{}) string {
+	var res []string
+	switch m := m.(type) {
+	case map[string]*Network:
+		for k := range m {
+			res = append(res, k)
+		}
+	case map[string]*Profile:
+		for k := range m {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
+
+func (c *Config) selectNetwork(name string) error {
+	if name == "" {
+		return nil
+	}
+	n, ok := c.Networks[name]
+	if !ok || n == nil {
+		return fmt.Errorf("unknown network %q, configured: %s", name, names(c.Networks))
+	}
+	c.Network = *n
+	c.NetworkName = name
+	return nil
+}
+
+func (c *Config) selectProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		return fmt.Errorf("unknown profile %q, configured: %s", name, names(c.Profiles))
+	}
+	c.Profile = *p
+	c.ProfileName = name
+	return nil
+}
+
+// applyEnv overrides the selected network with TEST_ETH_NODES (comma
+// separated urls), TEST_ETH_PRIVATE_KEY, TEST_ETH_CHAIN_ID, TEST_ETH_SIGNER,
+// TEST_ETH_GAS_PRICE and TEST_ETH_GAS_LIMIT, and MetricsAddr with
+// TEST_ETH_METRICS_ADDR.
+func (c *Config) applyEnv() error {
+	if v := os.Getenv(EnvPrefix + "NODES"); v != "" {
+		c.Node = ""
+		c.Nodes = nil
+		for _, url := range strings.Split(v, ",") {
+			c.Nodes = append(c.Nodes, Endpoint{Url: strings.TrimSpace(url), Weight: 1})
+		}
+	}
+	if v := os.Getenv(EnvPrefix + "PRIVATE_KEY"); v != "" {
+		c.PrivateKey = v
+	}
+	if v := os.Getenv(EnvPrefix + "CHAIN_ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%sCHAIN_ID: %v", EnvPrefix, err)
+		}
+		c.ChainID = id
+	}
+	if v := os.Getenv(EnvPrefix + "SIGNER"); v != "" {
+		c.Signer = v
+	}
+	if v := os.Getenv(EnvPrefix + "GAS_PRICE"); v != "" {
+		price, err := units.ParseAmount(v, units.Wei)
+		if err != nil {
+			return fmt.Errorf("%sGAS_PRICE: %v", EnvPrefix, err)
+		}
+		c.GasPrice = price
+	}
+	if v := os.Getenv(EnvPrefix + "GAS_LIMIT"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%sGAS_LIMIT: %v", EnvPrefix, err)
+		}
+		c.GasLimit = limit
+	}
+	if v := os.Getenv(EnvPrefix + "METRICS_ADDR"); v != "" {
+		c.MetricsAddr = v
+	}
+	return nil
+}
+
+func (n *Network) setDefaults() {
+	// crypto.HexToECDSA takes the key without prefix
+	n.PrivateKey = strings.TrimPrefix(n.PrivateKey, "0x")
+	if n.LoadBalance == "" {
+		n.LoadBalance = "round-robin"
+	}
+	if n.Signer == "" {
+		n.Signer = "latest"
+	}
+	if n.GasPrice == nil {
+		n.GasPrice = units.NewAmountOf(1, units.Gwei)
+	}
+	if n.GasLimit == 0 {
+		n.GasLimit = 21000
+	}
+}
+
+// DefaultProfile is the test defaults used for unset profile fields.
+func DefaultProfile() Profile {
+	return Profile{
+		RecordFrequency:          5,
+		TotalDataRecordFrequency: 20,
+		ConfirmPollInterval:      1000,
+		TxAmount:                 units.NewAmountOf(10000, units.Wei),
+		ShutdownGracePeriod:      30000,
+		TpsWindowBlocks:          20,
+		BlockSummaryFrequency:    100,
+	}
+}
+
+func (p *Profile) setDefaults() {
+	d := DefaultProfile()
+	if p.RecordFrequency == 0 {
+		p.RecordFrequency = d.RecordFrequency
+	}
+	if p.TotalDataRecordFrequency == 0 {
+		p.TotalDataRecordFrequency = d.TotalDataRecordFrequency
+	}
+	if p.ConfirmPollInterval == 0 {
+		p.ConfirmPollInterval = d.ConfirmPollInterval
+	}
+	if p.TxAmount == nil {
+		p.TxAmount = d.TxAmount
+	}
+	if p.ShutdownGracePeriod == 0 {
+		p.ShutdownGracePeriod = d.ShutdownGracePeriod
+	}
+	if p.TpsWindowBlocks == 0 {
+		p.TpsWindowBlocks = d.TpsWindowBlocks
+	}
+	if p.BlockSummaryFrequency == 0 {
+		p.BlockSummaryFrequency = d.BlockSummaryFrequency
+	}
+}
+
+// Validate checks the selected network and profile and the global settings.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, a...))
+		}
+	}
+	endpoints := c.Endpoints()
+	for _, e := range endpoints {
+		check(hasScheme(e.Url, "http://", "https://", "ws://", "wss://") || strings.HasSuffix(e.Url, ".ipc"),
+			"node url %q must be http(s), ws(s) or an ipc path", e.Url)
+		check(e.Weight >= 0, "weight of %s must not be negative", e.Url)
+	}
+	switch c.LoadBalance {
+	case "round-robin", "weighted", "sticky":
+	default:
+		errs = append(errs, fmt.Sprintf("LoadBalance %q must be round-robin, weighted or sticky", c.LoadBalance))
+	}
+	switch c.Signer {
+	case "latest", "london", "berlin", "eip155", "homestead":
+	default:
+		errs = append(errs, fmt.Sprintf("Signer %q must be latest, london, berlin, eip155 or homestead", c.Signer))
+	}
+	if c.PrivateKey != "" {
+		check(len(c.PrivateKey) == 64 && isHex(c.PrivateKey), "PrivateKey must be 32 bytes of hex")
+	}
+	check(c.GasLimit >= 21000, "GasLimit must be at least 21000")
+	check(c.BatchSize >= 0 && c.BatchFlushInterval >= 0, "BatchSize and BatchFlushInterval must not be negative")
+	check(c.TxpoolMonitorInterval >= 0, "TxpoolMonitorInterval must not be negative")
+	for name, level := range c.LogLevels {
+		_, err := log.ParseLevel(level)
+		check(err == nil, "LogLevels %s: %v", name, err)
+	}
+	check(c.LogMaxSize >= 0 && c.LogMaxAge >= 0 && c.LogMaxBackups >= 0, "LogMaxSize, LogMaxAge and LogMaxBackups must not be negative")
+	check(c.RecordFrequency > 0 && c.TotalDataRecordFrequency > 0, "RecordFrequency and TotalDataRecordFrequency must be positive")
+	check(c.ConfirmPollInterval > 0, "ConfirmPollInterval must be positive")
+	check(c.TpsWindowBlocks > 0 && c.BlockSummaryFrequency > 0, "TpsWindowBlocks and BlockSummaryFrequency must be positive")
+	check(c.ShutdownGracePeriod >= 0, "ShutdownGracePeriod must not be negative")
+	check(c.TargetTps >= 0, "TargetTps must not be negative")
+	for i, p := range c.Phases {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("phase %s has no Name", name))
+		}
+		check(p.Duration >= 0 && p.Txns >= 0 && p.Rounds >= 0, "phase %s: Duration, Txns and Rounds must not be negative", name)
+		switch p.Workload {
+		case "fund":
+		case "transfer":
+			check(p.Instances > 0, "phase %s: Instances must be positive", name)
+			check(p.Duration > 0 || p.Txns > 0 || p.Rounds > 0, "phase %s: a transfer phase needs a Duration, Txns or Rounds", name)
+		case "idle":
+			check(p.Duration > 0, "phase %s: an idle phase needs a Duration", name)
+		default:
+			errs = append(errs, fmt.Sprintf("phase %s: Workload %q must be fund, transfer or idle", name, p.Workload))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func hasScheme(url string, schemes ...string) bool {
+	for _, s := range schemes {
+		if strings.HasPrefix(url, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Endpoints returns Nodes, or Node alone when no Nodes are configured.
+func (n *Network) Endpoints() []Endpoint {
+	if len(n.Nodes) > 0 {
+		return n.Nodes
+	}
+	return []Endpoint{{Url: n.Node, Weight: 1}}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrivateKeyPrefix(t *testing.T) {
+	key := strings.Repeat("ab", 32)
+	file := filepath.Join(t.TempDir(), "config.json")
+	conf := `{"Node": "http://127.0.0.1:8545", "PrivateKey": "0x` + key + `"}`
+	if err := os.WriteFile(file, []byte(conf), 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.PrivateKey != key {
+		t.Errorf("PrivateKey %q, want it without 0x prefix", c.PrivateKey)
+	}
+}
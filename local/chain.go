@@ -0,0 +1,138 @@
+// Package local runs a single node proof-of-authority chain in process, with
+// its json-rpc on localhost and a pre-funded admin account, so that every
+// command can run without an external network.
+package local
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// the json-rpc apis served, txpool for the txpool monitor
+var httpModules = []string{"eth", "net", "web3", "txpool"}
+
+// level of the logs of the node itself
+var nodeLogLevel = gethlog.LvlError
+
+// Chain is a running local chain, its state is in memory and lost on Close.
+type Chain struct {
+	stack   *node.Node
+	backend *eth.Ethereum
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+}
+
+// Start starts a chain sealing a block every period seconds, 0 to seal only
+// when txns are pending, with its json-rpc at addr like "127.0.0.1:0" where
+// port 0 picks a free one.
+func Start(addr string, period uint64) (*Chain, error) {
+	host, port, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	gethlog.Root().SetHandler(gethlog.LvlFilterHandler(nodeLogLevel, gethlog.StreamHandler(os.Stderr, gethlog.TerminalFormat(false))))
+	stack, err := node.New(&node.Config{
+		Name:              "test-eth-local",
+		HTTPHost:          host,
+		HTTPPort:          port,
+		HTTPModules:       httpModules,
+		HTTPVirtualHosts:  []string{"*"},
+		UseLightweightKDF: true,
+		P2P: p2p.Config{
+			MaxPeers:    0,
+			NoDial:      true,
+			NoDiscovery: true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{stack: stack, key: key}
+	if err := c.start(period); err != nil {
+		stack.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Chain) start(period uint64) error {
+	// the admin account is the faucet of the genesis and the only signer
+	ks := c.stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	account, err := ks.ImportECDSA(c.key, "")
+	if err != nil {
+		return err
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		return err
+	}
+	genesis := core.DeveloperGenesisBlock(period, account.Address)
+	c.chainID = genesis.Config.ChainID
+
+	conf := ethconfig.Defaults
+	conf.Genesis = genesis
+	conf.NetworkId = genesis.Config.ChainID.Uint64()
+	conf.SyncMode = downloader.FullSync
+	conf.Miner.Etherbase = account.Address
+	conf.Miner.GasCeil = genesis.GasLimit
+	conf.Miner.GasPrice = big.NewInt(1)
+	conf.TxPool.PriceLimit = 1
+	backend, err := eth.New(c.stack, &conf)
+	if err != nil {
+		return err
+	}
+	c.backend = backend
+	if err := c.stack.Start(); err != nil {
+		return err
+	}
+	return backend.StartMining(1)
+}
+
+// URL is the json-rpc endpoint of the chain.
+func (c *Chain) URL() string {
+	return c.stack.HTTPEndpoint()
+}
+
+// PrivateKey is the hex key of the pre-funded admin account.
+func (c *Chain) PrivateKey() string {
+	return hexutil.Encode(crypto.FromECDSA(c.key))[2:]
+}
+
+func (c *Chain) ChainID() uint64 {
+	return c.chainID.Uint64()
+}
+
+func (c *Chain) Close() error {
+	c.backend.StopMining()
+	return c.stack.Close()
+}
+
+func splitAddr(addr string) (string, int, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("bad port in %q", addr)
+	}
+	return host, int(n), nil
+}
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	TextFormat = iota
+	JSONFormat
+)
+
+var plainLevels = map[int]string{
+	DebugLog: "[DEBUG]",
+	InfoLog:  "[INFO ]",
+	WarnLog:  "[WARN ]",
+	ErrorLog: "[ERROR]",
+	FatalLog: "[FATAL]",
+	TraceLog: "[TRACE]",
+}
+
+var jsonLevels = map[int]string{
+	DebugLog: "debug",
+	InfoLog:  "info",
+	WarnLog:  "warn",
+	ErrorLog: "error",
+	FatalLog: "fatal",
+	TraceLog: "trace",
+}
+
+// ParseFormat turns "text" or "json" into TextFormat or JSONFormat.
+func ParseFormat(name string) (int, error) {
+	switch name {
+	case "text", "":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return 0, fmt.Errorf("unknown log format %q, must be text or json", name)
+}
+
+// isTerminal tells whether every writer of out is a terminal, colors are
+// only written then.
+func isTerminal(out []io.Writer) bool {
+	if len(out) == 0 {
+		return false
+	}
+	for _, w := range out {
+		f, ok := w.(*os.File)
+		if !ok {
+			return false
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFields tells a structured call, a message followed by key/value
+// pairs with string keys like Info("tx confirmed", "hash", h, "ms", ms),
+// from a plain Info(a, b, c).
+func splitFields(a []interface{}) (msg string, fields []interface{}, ok bool) {
+	if len(a) < 3 || len(a)%2 == 0 {
+		return "", nil, false
+	}
+	msg, ok = a[0].(string)
+	if !ok {
+		return "", nil, false
+	}
+	for i := 1; i < len(a); i += 2 {
+		if _, ok := a[i].(string); !ok {
+			return "", nil, false
+		}
+	}
+	return msg, a[1:], true
+}
+
+// fieldValue is how a value is written in text lines.
+func fieldValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || bytes.ContainsAny([]byte(s), " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (l *Logger) encodeText(level int, gid uint64, msg string, fields []interface{}) string {
+	name := plainLevels[level]
+	if l.color {
+		name = LevelName(level)
+	}
+	if name == "" {
+		name = NAME_PREFIX + strconv.Itoa(level)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s GID %d, %s", name, gid, msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %s=%s", fields[i], fieldValue(fields[i+1]))
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func (l *Logger) encodeJSON(level int, gid uint64, msg string, fields []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, jsonLevels[level])
+	fmt.Fprintf(&b, `,"gid":%d,"msg":`, gid)
+	writeJSONValue(&b, msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		b.WriteByte(',')
+		writeJSONValue(&b, fmt.Sprint(fields[i]))
+		b.WriteByte(':')
+		writeJSONValue(&b, fields[i+1])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case error:
+		v = x.Error()
+	case fmt.Stringer:
+		if _, ok := v.(json.Marshaler); !ok {
+			v = x.String()
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
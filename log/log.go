@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -95,52 +96,82 @@ func NameLevel(name string) int {
 }
 
 type Logger struct {
-	level   int
+	level   int32 // atomic, changed while other goroutines log
+	format  int   // TextFormat or JSONFormat
+	color   bool  // colored level names, text format only
 	logger  *log.Logger
 	logFile *os.File
+
+	rotating *RotatingFile
 }
 
 func New(out io.Writer, prefix string, flag, level int, file *os.File) *Logger {
 	return &Logger{
-		level:   level,
+		level:   int32(level),
+		color:   true,
 		logger:  log.New(out, prefix, flag),
 		logFile: file,
 	}
 }
 
+// SetFormat switches between TextFormat and JSONFormat lines. JSON lines
+// carry their own time so the date prefix is dropped.
+func (l *Logger) SetFormat(format int) {
+	l.format = format
+	if format == JSONFormat {
+		l.logger.SetFlags(0)
+	} else {
+		l.logger.SetFlags(log.Ldate | log.Lmicroseconds)
+	}
+}
+
+func (l *Logger) SetColor(color bool) {
+	l.color = color
+}
+
 func (l *Logger) SetDebugLevel(level int) error {
 	if level > MaxLevelLog || level < 0 {
 		return errors.New("Invalid Debug Level")
 	}
 
-	l.level = level
+	atomic.StoreInt32(&l.level, int32(level))
 	return nil
 }
 
-func (l *Logger) Output(level int, a ...interface{}) error {
-	if level >= l.level {
-		gid := GetGID()
-		gidStr := strconv.FormatUint(gid, 10)
-
-		a = append([]interface{}{LevelName(level), "GID",
-			gidStr + ","}, a...)
+// Level is the lowest level written.
+func (l *Logger) Level() int {
+	return int(atomic.LoadInt32(&l.level))
+}
 
-		return l.logger.Output(CALL_DEPTH, fmt.Sprintln(a...))
+// Output logs a, either a message followed by key/value fields, like
+// Output(InfoLog, "tx confirmed", "hash", h, "ms", ms), or plain values
+// printed as by fmt.Sprintln.
+func (l *Logger) Output(level int, a ...interface{}) error {
+	if level >= l.Level() {
+		msg, fields, ok := splitFields(a)
+		if !ok {
+			msg = strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+		}
+		return l.write(level, msg, fields)
 	}
 	return nil
 }
 
 func (l *Logger) Outputf(level int, format string, v ...interface{}) error {
-	if level >= l.level {
-		gid := GetGID()
-		v = append([]interface{}{LevelName(level), "GID",
-			gid}, v...)
-
-		return l.logger.Output(CALL_DEPTH, fmt.Sprintf("%s %s %d, "+format+"\n", v...))
+	if level >= l.Level() {
+		return l.write(level, fmt.Sprintf(format, v...), nil)
 	}
 	return nil
 }
 
+func (l *Logger) write(level int, msg string, fields []interface{}) error {
+	gid := GetGID()
+	if l.format == JSONFormat {
+		return l.logger.Output(CALL_DEPTH+1, l.encodeJSON(level, gid, msg, fields))
+	}
+	return l.logger.Output(CALL_DEPTH+1, l.encodeText(level, gid, msg, fields))
+}
+
 func (l *Logger) Trace(a ...interface{}) {
 	l.Output(TraceLog, a...)
 }
@@ -190,7 +221,7 @@ func (l *Logger) Fatalf(format string, a ...interface{}) {
 }
 
 func Trace(a ...interface{}) {
-	if TraceLog < Log.level {
+	if TraceLog < Log.Level() {
 		return
 	}
 
@@ -204,13 +235,13 @@ func Trace(a ...interface{}) {
 	nameEnd := filepath.Ext(nameFull)
 	funcName := strings.TrimPrefix(nameEnd, ".")
 
-	a = append([]interface{}{funcName + "()", fileName + ":" + strconv.Itoa(line)}, a...)
+	a = withCaller(a, funcName+"()", fileName+":"+strconv.Itoa(line))
 
 	Log.Trace(a...)
 }
 
 func Tracef(format string, a ...interface{}) {
-	if TraceLog < Log.level {
+	if TraceLog < Log.Level() {
 		return
 	}
 
@@ -230,7 +261,7 @@ func Tracef(format string, a ...interface{}) {
 }
 
 func Debug(a ...interface{}) {
-	if DebugLog < Log.level {
+	if DebugLog < Log.Level() {
 		return
 	}
 
@@ -240,13 +271,13 @@ func Debug(a ...interface{}) {
 	file, line := f.FileLine(pc[0])
 	fileName := filepath.Base(file)
 
-	a = append([]interface{}{f.Name(), fileName + ":" + strconv.Itoa(line)}, a...)
+	a = withCaller(a, f.Name(), fileName+":"+strconv.Itoa(line))
 
 	Log.Debug(a...)
 }
 
 func Debugf(format string, a ...interface{}) {
-	if DebugLog < Log.level {
+	if DebugLog < Log.Level() {
 		return
 	}
 
@@ -261,6 +292,15 @@ func Debugf(format string, a ...interface{}) {
 	Log.Debugf("%s %s:%d "+format, a...)
 }
 
+// withCaller adds the calling function and line to a, as a field when a is
+// structured.
+func withCaller(a []interface{}, funcName, fileLine string) []interface{} {
+	if msg, fields, ok := splitFields(a); ok {
+		return append([]interface{}{msg, "caller", funcName + " " + fileLine}, fields...)
+	}
+	return append([]interface{}{funcName, fileLine}, a...)
+}
+
 func Info(a ...interface{}) {
 	Log.Info(a...)
 }
@@ -326,6 +366,7 @@ func Init(a ...interface{}) {
 func InitLog(logLevel int, a ...interface{}) {
 	writers := []io.Writer{}
 	var logFile *os.File
+	var rotating *RotatingFile
 	var err error
 	if len(a) == 0 {
 		writers = append(writers, ioutil.Discard)
@@ -341,6 +382,9 @@ func InitLog(logLevel int, a ...interface{}) {
 				writers = append(writers, logFile)
 			case *os.File:
 				writers = append(writers, o.(*os.File))
+			case *RotatingFile:
+				rotating = o.(*RotatingFile)
+				writers = append(writers, rotating)
 			default:
 				fmt.Println("error: invalid log location")
 				os.Exit(1)
@@ -348,10 +392,25 @@ func InitLog(logLevel int, a ...interface{}) {
 		}
 	}
 	fileAndStdoutWrite := io.MultiWriter(writers...)
+	format := TextFormat
+	if Log != nil {
+		format = Log.format
+	}
 	Log = New(fileAndStdoutWrite, "", log.Ldate|log.Lmicroseconds, logLevel, logFile)
+	Log.rotating = rotating
+	Log.SetFormat(format)
+	Log.SetColor(isTerminal(writers))
+}
+
+// SetFormat sets the format of the default logger, TextFormat or JSONFormat.
+func SetFormat(format int) {
+	Log.SetFormat(format)
 }
 
 func GetLogFileSize() (int64, error) {
+	if Log.rotating != nil {
+		return Log.rotating.Size(), nil
+	}
 	f, e := Log.logFile.Stat()
 	if e != nil {
 		return 0, e
@@ -385,5 +444,8 @@ func ClosePrintLog() error {
 	if Log.logFile != nil {
 		err = Log.logFile.Close()
 	}
+	if Log.rotating != nil {
+		err = Log.rotating.Close()
+	}
 	return err
 }
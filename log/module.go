@@ -0,0 +1,270 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// inheritLevel makes a module log at the level of the default logger.
+const inheritLevel = -1
+
+// DefaultModule names the default logger where module levels are set, its
+// level is the one of every module without its own.
+const DefaultModule = "default"
+
+// ModuleLogger writes through the default logger with its own level, so the
+// level of one component can be raised without flooding the others.
+type ModuleLogger struct {
+	name  string
+	level int32 // atomic, inheritLevel until set
+}
+
+var modules = struct {
+	sync.Mutex
+	loggers map[string]*ModuleLogger
+	levels  map[string]int // configured, by module or group name
+}{loggers: map[string]*ModuleLogger{}, levels: map[string]int{}}
+
+// Module returns the logger of the named module, creating it on first use.
+// A name like "instance-3" is in the group "instance", and takes the level
+// of the group unless its own is set.
+func Module(name string) *ModuleLogger {
+	modules.Lock()
+	defer modules.Unlock()
+	if m, ok := modules.loggers[name]; ok {
+		return m
+	}
+	m := &ModuleLogger{name: name, level: int32(levelOf(name))}
+	modules.loggers[name] = m
+	return m
+}
+
+// group is name without its "-N" suffix.
+func group(name string) string {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 || i == len(name)-1 {
+		return name
+	}
+	for _, c := range name[i+1:] {
+		if c < '0' || c > '9' {
+			return name
+		}
+	}
+	return name[:i]
+}
+
+// levelOf is the configured level of name, modules must be locked.
+func levelOf(name string) int {
+	if l, ok := modules.levels[name]; ok {
+		return l
+	}
+	if l, ok := modules.levels[group(name)]; ok {
+		return l
+	}
+	return inheritLevel
+}
+
+func updateModules() {
+	for name, m := range modules.loggers {
+		atomic.StoreInt32(&m.level, int32(levelOf(name)))
+	}
+}
+
+// SetModuleLevel sets the level of a module or a group of modules, -1 goes
+// back to the level of the default logger. DefaultModule sets the level of the
+// default logger.
+func SetModuleLevel(name string, level int) error {
+	if level >= MaxLevelLog || level < inheritLevel {
+		return fmt.Errorf("invalid log level %d", level)
+	}
+	if name == DefaultModule {
+		if level == inheritLevel {
+			return fmt.Errorf("%s has no level to inherit", DefaultModule)
+		}
+		return Log.SetDebugLevel(level)
+	}
+	modules.Lock()
+	defer modules.Unlock()
+	if level == inheritLevel {
+		delete(modules.levels, name)
+	} else {
+		modules.levels[name] = level
+	}
+	updateModules()
+	return nil
+}
+
+// SetModuleLevels replaces every module level by levels, the level of
+// DefaultModule, when given, is set on the default logger.
+func SetModuleLevels(levels map[string]int) error {
+	for name, level := range levels {
+		if level >= MaxLevelLog || level < 0 {
+			return fmt.Errorf("invalid log level %d of %s", level, name)
+		}
+	}
+	if level, ok := levels[DefaultModule]; ok {
+		Log.SetDebugLevel(level)
+	}
+	modules.Lock()
+	defer modules.Unlock()
+	modules.levels = map[string]int{}
+	for name, level := range levels {
+		if name != DefaultModule {
+			modules.levels[name] = level
+		}
+	}
+	updateModules()
+	return nil
+}
+
+// ModuleLevels returns the level name of every module in use and of every
+// configured module or group.
+func ModuleLevels() map[string]string {
+	modules.Lock()
+	defer modules.Unlock()
+	res := map[string]string{}
+	for name, level := range modules.levels {
+		res[name] = jsonLevels[level]
+	}
+	for name, m := range modules.loggers {
+		res[name] = jsonLevels[m.effectiveLevel()]
+	}
+	return res
+}
+
+// ParseLevel reads a level name as written in json lines, e.g. "debug".
+func ParseLevel(name string) (int, error) {
+	for level, n := range jsonLevels {
+		if n == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, must be trace, debug, info, warn, error or fatal", name)
+}
+
+func (m *ModuleLogger) effectiveLevel() int {
+	if level := int(atomic.LoadInt32(&m.level)); level != inheritLevel {
+		return level
+	}
+	return Log.Level()
+}
+
+// Enabled tells if a line of level would be written, to skip building
+// costly arguments.
+func (m *ModuleLogger) Enabled(level int) bool {
+	return level >= m.effectiveLevel()
+}
+
+// Output logs a like Logger.Output, with the module name as a field.
+func (m *ModuleLogger) Output(level int, a ...interface{}) {
+	if !m.Enabled(level) {
+		return
+	}
+	msg, fields, ok := splitFields(a)
+	if !ok {
+		msg = strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	}
+	Log.write(level, msg, append([]interface{}{"module", m.name}, fields...))
+}
+
+func (m *ModuleLogger) Outputf(level int, format string, a ...interface{}) {
+	if !m.Enabled(level) {
+		return
+	}
+	Log.write(level, fmt.Sprintf(format, a...), []interface{}{"module", m.name})
+}
+
+func (m *ModuleLogger) Trace(a ...interface{}) {
+	m.Output(TraceLog, a...)
+}
+
+func (m *ModuleLogger) Tracef(format string, a ...interface{}) {
+	m.Outputf(TraceLog, format, a...)
+}
+
+func (m *ModuleLogger) Debug(a ...interface{}) {
+	m.Output(DebugLog, a...)
+}
+
+func (m *ModuleLogger) Debugf(format string, a ...interface{}) {
+	m.Outputf(DebugLog, format, a...)
+}
+
+func (m *ModuleLogger) Info(a ...interface{}) {
+	m.Output(InfoLog, a...)
+}
+
+func (m *ModuleLogger) Infof(format string, a ...interface{}) {
+	m.Outputf(InfoLog, format, a...)
+}
+
+func (m *ModuleLogger) Warn(a ...interface{}) {
+	m.Output(WarnLog, a...)
+}
+
+func (m *ModuleLogger) Warnf(format string, a ...interface{}) {
+	m.Outputf(WarnLog, format, a...)
+}
+
+func (m *ModuleLogger) Error(a ...interface{}) {
+	m.Output(ErrorLog, a...)
+}
+
+func (m *ModuleLogger) Errorf(format string, a ...interface{}) {
+	m.Outputf(ErrorLog, format, a...)
+}
+
+func (m *ModuleLogger) Fatal(a ...interface{}) {
+	m.Output(FatalLog, a...)
+	os.Exit(1)
+}
+
+func (m *ModuleLogger) Fatalf(format string, a ...interface{}) {
+	m.Outputf(FatalLog, format, a...)
+	os.Exit(1)
+}
+
+// LevelHandler serves the module levels: GET lists them as json, POST with
+// the form values module and level sets one, level "inherit" resets it.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			name, levelName := r.FormValue("module"), r.FormValue("level")
+			if name == "" {
+				http.Error(w, "missing module", http.StatusBadRequest)
+				return
+			}
+			level := inheritLevel
+			if levelName != "inherit" {
+				var err error
+				if level, err = ParseLevel(levelName); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if err := SetModuleLevel(name, level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			Info("Log level changed", "module", name, "level", levelName)
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Default string            `json:"default"`
+			Modules map[string]string `json:"modules"`
+		}{jsonLevels[Log.Level()], ModuleLevels()})
+	})
+}
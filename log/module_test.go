@@ -0,0 +1,59 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestLevelHandlerDefault(t *testing.T) {
+	InitLog(InfoLog)
+	defer InitLog(InfoLog, Stdout)
+	h := LevelHandler()
+	post := func(module, level string) int {
+		req := httptest.NewRequest(http.MethodPost, "/log/levels", nil)
+		req.PostForm = url.Values{"module": {module}, "level": {level}}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(DefaultModule, "debug"); code != http.StatusOK {
+		t.Fatalf("set default level: status %d", code)
+	}
+	if Log.Level() != DebugLog {
+		t.Errorf("default level %d, want %d", Log.Level(), DebugLog)
+	}
+	if _, ok := ModuleLevels()[DefaultModule]; ok {
+		t.Error("default is listed as a module")
+	}
+	if !Module("test").Enabled(DebugLog) {
+		t.Error("module without its own level does not inherit debug")
+	}
+	if code := post(DefaultModule, "inherit"); code != http.StatusBadRequest {
+		t.Errorf("default inherit: status %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestSetLevelWhileLogging(t *testing.T) {
+	InitLog(InfoLog)
+	defer InitLog(InfoLog, Stdout)
+	m := Module("race")
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			Infof("line %d", i)
+			m.Debugf("line %d", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			SetModuleLevels(map[string]int{DefaultModule: i % 2 * DebugLog})
+		}
+	}()
+	wg.Wait()
+}
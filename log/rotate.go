@@ -0,0 +1,236 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const logFileSuffix = "_LOG.log"
+
+// RotateOptions of a RotatingFile, zero values disable the matching limit.
+type RotateOptions struct {
+	MaxSize    int64         // byte
+	MaxAge     time.Duration // of the current file
+	MaxBackups int           // rotated files kept, older ones are removed
+	Compress   bool          // gzip rotated files
+}
+
+// RotatingFile is a log file in a directory, named like FileOpen names them.
+// It starts a new file when the current one grows over MaxSize or gets older
+// than MaxAge. Writes are safe for concurrent use.
+type RotatingFile struct {
+	dir  string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+	base   string // timestamp of the current file name
+	seq    int    // counter of the files started within the same second
+
+	// rotated files are compressed and pruned in order by one goroutine,
+	// rotate only queues them so that writes never wait for it
+	rotated []string      // queued for cleanup, guarded by mu
+	wake    chan struct{} // tells cleanup that files are queued
+	backups []string      // files rotated by r, oldest first, owned by cleanup
+	done    chan struct{}
+}
+
+func NewRotatingFile(dir string, opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(dir, 0766); err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{dir: dir, opts: opts, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.cleanup()
+	return r, nil
+}
+
+// open starts a new file, with a counter when the timestamp is already taken.
+func (r *RotatingFile) open() error {
+	now := time.Now()
+	base := filepath.Join(r.dir, now.Format("2006-01-02_15.04.05"))
+	if base == r.base {
+		r.seq++
+	} else {
+		r.base, r.seq = base, 0
+	}
+	name := base + logFileSuffix
+	if r.seq > 0 {
+		name = fmt.Sprintf("%s.%d%s", base, r.seq, logFileSuffix)
+	}
+	for fileExists(name) || fileExists(name+".gz") {
+		r.seq++
+		name = fmt.Sprintf("%s.%d%s", base, r.seq, logFileSuffix)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.size = 0
+	r.opened = now
+	return nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.needRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) needRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+next > r.opts.MaxSize {
+		return true
+	}
+	return r.opts.MaxAge > 0 && time.Since(r.opened) >= r.opts.MaxAge
+}
+
+// Rotate starts a new file now.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	old := r.file.Name()
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	r.rotated = append(r.rotated, old)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+		// cleanup is already told
+	}
+	return nil
+}
+
+func (r *RotatingFile) cleanup() {
+	defer close(r.done)
+	for range r.wake {
+		r.mu.Lock()
+		rotated := r.rotated
+		r.rotated = nil
+		r.mu.Unlock()
+		for _, old := range rotated {
+			r.cleanupFile(old)
+		}
+	}
+}
+
+// cleanupFile compresses old when enabled and prunes the backups.
+func (r *RotatingFile) cleanupFile(old string) {
+	if r.opts.Compress {
+		if err := compressFile(old); err != nil {
+			fmt.Fprintf(os.Stderr, "compress log file %s: %v\n", old, err)
+		} else {
+			old += ".gz"
+		}
+	}
+	r.backups = append(r.backups, old)
+	r.prune()
+}
+
+// compressFile replaces name by name.gz, keeping its modification time.
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+// prune removes the oldest files rotated by r over MaxBackups. Other files in
+// the directory, like the ones of other processes, are left alone.
+func (r *RotatingFile) prune() {
+	if r.opts.MaxBackups <= 0 {
+		return
+	}
+	for len(r.backups) > r.opts.MaxBackups {
+		os.Remove(r.backups[0])
+		r.backups = r.backups[1:]
+	}
+}
+
+// Size is the size of the current file.
+func (r *RotatingFile) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Close closes the current file and waits for pending compressions.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return os.ErrClosed
+	}
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.closed = true
+	close(r.wake)
+	r.mu.Unlock()
+	<-r.done
+	return err
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneKeepsFilesOfOthers(t *testing.T) {
+	dir := t.TempDir()
+	// the current and a rotated file of another process
+	others := []string{
+		filepath.Join(dir, "2000-01-01_00.00.00"+logFileSuffix),
+		filepath.Join(dir, "2000-01-01_00.00.01"+logFileSuffix+".gz"),
+	}
+	for _, name := range others {
+		if err := os.WriteFile(name, []byte("other\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewRotatingFile(dir, RotateOptions{MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < 4; i++ {
+		r.Write([]byte("line\n"))
+		r.mu.Lock()
+		names = append(names, r.file.Name())
+		r.mu.Unlock()
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	for _, name := range others {
+		if !fileExists(name) {
+			t.Errorf("%s of another process was removed", name)
+		}
+	}
+	// 4 rotated files, the 2 newest are kept
+	for i, name := range names {
+		if kept := fileExists(name); kept != (i >= 2) {
+			t.Errorf("rotated file %d kept %t", i, kept)
+		}
+	}
+}
+
+func TestRotateQueuesPastCleanup(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotatingFile(dir, RotateOptions{MaxBackups: 3, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// more rotations than the cleanup goroutine can keep up with
+	for i := 0; i < 100; i++ {
+		r.Write([]byte("line\n"))
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+logFileSuffix+".gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("%d compressed backups kept, want 3", len(files))
+	}
+}
@@ -3,171 +3,224 @@ package main
 import (
 	"context"
 	"flag"
-	"math/big"
-	"strconv"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/KSlashh/test-eth/api"
 	"github.com/KSlashh/test-eth/config"
+	localchain "github.com/KSlashh/test-eth/local"
 	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/metrics"
 	"github.com/KSlashh/test-eth/testUtils"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 var confFile string
-var function string
+var network string
+var profile string
+var output string
+var logFormat string
+var local bool
+var localAddr string
+var localPeriod uint64
+
+// the chain started by -local, closed before exiting
+var localChain *localchain.Chain
+
+var healthCheckInterval = time.Second * 5
 
 func init() {
 	flag.StringVar(&confFile, "conf", "./config.json", "configuration file path")
-	flag.StringVar(&function, "func", "test2", "choose function to run:\n"+
-		"  getBalance [address]\n"+
-		"  getBalanceAt [address] [height]\n"+
-		"  getHeader [height]\n"+
-		"  transferEther [toAddress] [amount/(wei)]\n"+
-		"  testInfinite [instanceAmount] [initEther/(ether)(default 1)]\n"+
-		"  testFixedRound [instanceAmount] [round] [initEther/(ether)(default 1)]\n"+
-		"  testFixedTime [instanceAmount] [duration/(second)] [initEther/(ether)(default 1)]\n+"+
-		"  test2 [instanceAmount(default 1)] [initEther/(ether)(default 10)]\n+"+
-		"  record [startHeight]")
+	flag.StringVar(&network, "network", "", "named network of the configuration to use (default $"+config.EnvPrefix+"NETWORK, then DefaultNetwork)")
+	flag.StringVar(&profile, "profile", "", "named test profile of the configuration to use (default $"+config.EnvPrefix+"PROFILE, then DefaultProfile)")
+	flag.StringVar(&output, "output", "text", "output format of query commands: text, or json written to stdout with logs moved to stderr")
+	flag.StringVar(&logFormat, "log-format", "text", "log line format: text, or json with one object per line")
+	flag.BoolVar(&local, "local", false, "run the command against a chain started in process, with a pre-funded admin account; -conf is then optional and its networks are ignored")
+	flag.StringVar(&localAddr, "local-addr", "127.0.0.1:0", "json-rpc `address` of the -local chain, port 0 picks a free one")
+	flag.Uint64Var(&localPeriod, "local-period", 1, "block period of the -local chain in `seconds`, 0 to seal only when txns are pending")
+	flag.Usage = usage
+}
 
+func main() {
 	flag.Parse()
+	if output != "text" && output != "json" {
+		fmt.Fprintf(os.Stderr, "invalid -output %q, must be text or json\n", output)
+		os.Exit(2)
+	}
+	format, err := log.ParseFormat(logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log.SetFormat(format)
+	if output == "json" {
+		// keep stdout for the json result only
+		log.InitLog(log.InfoLog, os.Stderr)
+	}
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(2)
+	}
+	c := findCommand(flag.Arg(0), flag.Arg(1))
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0)+" "+flag.Arg(1))
+		usage()
+		os.Exit(2)
+	}
 
+	// SIGINT/SIGTERM stop new sends, running tests then wait for pending txns
+	// and print their final data before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// restore the default handling, so that a second signal kills the
+		// process during the grace period
+		<-ctx.Done()
+		stop()
+	}()
+	code := runCommand(ctx, c, flag.Args()[2:])
+	stop()
+	if localChain != nil {
+		localChain.Close()
+	}
+	log.ClosePrintLog()
+	os.Exit(code)
 }
 
-func main() {
-	conf, err := config.LoadConfig(confFile)
+// logToDir makes the logs also go to rotated files in conf.LogDir.
+func logToDir(conf *config.Config) error {
+	file, err := log.NewRotatingFile(conf.LogDir, log.RotateOptions{
+		MaxSize:    int64(conf.LogMaxSize) * log.BYTE_TO_MB,
+		MaxAge:     time.Duration(conf.LogMaxAge) * time.Hour,
+		MaxBackups: conf.LogMaxBackups,
+		Compress:   conf.LogCompress,
+	})
 	if err != nil {
-		log.Fatal("LoadConfig fail", err)
+		return err
+	}
+	console := os.Stdout
+	if output == "json" {
+		console = os.Stderr
 	}
-	client, err := ethclient.Dial(conf.Node)
+	log.InitLog(log.InfoLog, console, file)
+	return nil
+}
+
+// env is the configuration and the node connections, commands build it with
+// connect, or connectSigner when they sign txns, once their flags are
+// validated.
+type env struct {
+	conf           *config.Config
+	pool           *api.ClientPool
+	client         *ethclient.Client
+	txpoolInterval time.Duration
+}
+
+// startLocalChain starts the -local chain and returns its node as network.
+func startLocalChain() (config.Network, error) {
+	chain, err := localchain.Start(localAddr, localPeriod)
 	if err != nil {
-		log.Fatalf("Fail to dial client")
+		return config.Network{}, fmt.Errorf("Fail to start local chain: %v", err)
 	}
+	localChain = chain
+	log.Info("Local chain started", "url", chain.URL(), "chain", chain.ChainID(), "period", localPeriod)
+	return config.Network{
+		Node:       chain.URL(),
+		PrivateKey: chain.PrivateKey(),
+		ChainID:    chain.ChainID(),
+	}, nil
+}
 
-	switch function {
-	case "getTxnsCount":
-		height, _ := new(big.Int).SetString(flag.Arg(0), 10)
-		//height := new(big.Int).SetUint64(83082)
-		header, err := client.HeaderByNumber(context.Background(), height)
-		if err != nil {
-			log.Fatal("get header fail ", err)
-		}
-		count, err := client.TransactionCount(context.Background(), header.Hash())
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Infof("for block %s at height %s , txns count %d", header.Hash(), header.Number.String(), count)
-	case "record":
-		startHeight := big.NewInt(1)
-		startHeight.SetString(flag.Arg(0), 10)
-		testUtils.Recorder2(client, startHeight)
-	case "test2":
-		instanceAmount := 1
-		initEther := big.NewInt(1000000000000000000)
-		initEther.Mul(initEther, big.NewInt(10))
-		args := flag.Args()
-		switch len(args) {
-		case 1:
-			instanceAmount, err = strconv.Atoi(flag.Arg(0))
-			if err != nil {
-				instanceAmount = 1
-			}
-		case 2:
-			instanceAmount, err = strconv.Atoi(flag.Arg(0))
-			if err != nil {
-				instanceAmount = 1
-			}
-			initEther, ok := initEther.SetString(flag.Arg(1), 10)
-			initEther.Mul(initEther, big.NewInt(1000000000000000000))
-			if !ok {
-				initEther.Mul(big.NewInt(1000000000000000000), big.NewInt(10))
-			}
-		default:
-		}
-		testUtils.TestServer2(instanceAmount, conf.Node, conf.PrivateKey, initEther)
-	case "transferEther":
-		amount := big.NewInt(0)
-		amount, ok := amount.SetString(flag.Arg(1), 10)
-		if !ok {
-			log.Fatal("Fail to parse args! Second arg must be int.", err)
-		}
-		hash, err := api.TransferEth(client, conf.PrivateKey, flag.Arg(0), amount)
-		if err != nil {
-			log.Fatal("TransferEther fail", err)
-		}
-		log.Infof("Success! Transfer Ether at Tx %x .", hash)
-	case "getBalance":
-		address := flag.Arg(0)
-		balance, err := api.GetBalance(client, address)
-		if err != nil {
-			log.Fatal("GetBalance fail", err)
-		}
-		log.Infof("balance of %s is %d", address, balance)
-	case "getBalanceAt":
-		address := flag.Arg(0)
-		blockHeight, err := strconv.Atoi(flag.Arg(1))
-		if err != nil {
-			log.Fatal("Fail to parse args! Second arg must be int.", err)
-		}
-		balance, err := api.GetBalanceAt(client, address, int64(blockHeight))
-		if err != nil {
-			log.Fatal("GetBalance fail", err)
-		}
-		log.Infof("balance of %s at height %d is %d", address, blockHeight, balance)
-	case "getHeader":
-		blockHeight, err := strconv.Atoi(flag.Arg(0))
-		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
-		}
-		header, err := api.GetBlockHeader(client, int64(blockHeight))
-		if err != nil {
-			log.Fatal("GetHeader fail", err)
-		}
-		log.Info(header)
-	case "testInfinite":
-		instanceAmount, err := strconv.Atoi(flag.Arg(0))
-		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
-		}
-		initEther := big.NewInt(1000000000000000000)
-		amount := big.NewInt(0)
-		amount, ok := amount.SetString(flag.Arg(1), 10)
-		if ok {
-			initEther = amount
-		}
-		testUtils.TestServer(instanceAmount, conf.Node, conf.PrivateKey, initEther, 0, 0)
-	case "testFixedTime":
-		instanceAmount, err := strconv.Atoi(flag.Arg(0))
-		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
-		}
-		testDuration, err := strconv.Atoi(flag.Arg(1)) // second
-		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
-		}
-		initEther := big.NewInt(1000000000000000000)
-		amount := big.NewInt(0)
-		amount, ok := amount.SetString(flag.Arg(2), 10)
-		if ok {
-			initEther = amount
-		}
-		testUtils.TestServer(instanceAmount, conf.Node, conf.PrivateKey, initEther, testDuration, 0)
-	case "testFixedRound":
-		instanceAmount, err := strconv.Atoi(flag.Arg(0))
-		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
+func connect(ctx context.Context) (*env, error) {
+	return connectNetwork(ctx, false)
+}
+
+// connectSigner is connect for the commands which sign txns, they fail before
+// dialing any node when no PrivateKey is configured.
+func connectSigner(ctx context.Context) (*env, error) {
+	return connectNetwork(ctx, true)
+}
+
+func connectNetwork(ctx context.Context, signs bool) (*env, error) {
+	var conf *config.Config
+	var err error
+	if local {
+		var n config.Network
+		if n, err = startLocalChain(); err != nil {
+			return nil, err
+		}
+		conf, err = config.LoadLocal(confFile, profile, n)
+	} else {
+		conf, err = config.Load(confFile, network, profile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadConfig fail: %v", err)
+	}
+	if signs && conf.PrivateKey == "" {
+		return nil, fmt.Errorf("no PrivateKey configured, set it in %s or %sPRIVATE_KEY", confFile, config.EnvPrefix)
+	}
+	if conf.LogDir != "" {
+		if err := logToDir(conf); err != nil {
+			return nil, fmt.Errorf("Fail to open log dir: %v", err)
 		}
-		testRound, err := strconv.Atoi(flag.Arg(1))
+	}
+	if err := applyLogLevels(conf.LogLevels); err != nil {
+		return nil, err
+	}
+	reloadLogLevelsOnHup()
+	if conf.AdminAddr != "" {
+		serveAdmin(conf.AdminAddr)
+	}
+	api.SignerName = conf.Signer
+	api.GasPrice = conf.GasPrice
+	api.TransferGasLimit = conf.GasLimit
+	testUtils.SetProfile(&conf.Profile)
+	if err := testUtils.EnableSLOs(conf.SLOs, conf.TargetTps, conf.FailFast); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", confFile, err)
+	}
+	if conf.NetworkName != "" || conf.ProfileName != "" {
+		log.Info("Using config", "network", conf.NetworkName, "profile", conf.ProfileName)
+	}
+	var urls []string
+	var weights []int
+	for _, e := range conf.Endpoints() {
+		urls = append(urls, e.Url)
+		weights = append(weights, e.Weight)
+	}
+	pool, err := api.NewClientPool(urls, weights, conf.LoadBalance)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to dial client: %v", err)
+	}
+	chainID, err := pool.CheckChainID(ctx, conf.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Connected", "chain", chainID, "nodes", len(urls))
+	pool.StartHealthCheck(healthCheckInterval)
+	if conf.MetricsAddr != "" {
+		metrics.Serve(conf.MetricsAddr)
+		testUtils.AddSink(testUtils.NewMetricsSink())
+	}
+	txpoolInterval := time.Duration(conf.TxpoolMonitorInterval) * time.Millisecond
+	if txpoolInterval > 0 {
+		testUtils.EnableTxpoolMonitor(txpoolInterval)
+	}
+	if conf.EventsFile != "" {
+		sink, err := testUtils.NewFileSink(conf.EventsFile)
 		if err != nil {
-			log.Fatal("Fail to parse args! First arg must be int.", err)
+			return nil, fmt.Errorf("Fail to create events file: %v", err)
 		}
-		initEther := big.NewInt(1000000000000000000)
-		amount := big.NewInt(0)
-		amount, ok := amount.SetString(flag.Arg(2), 10)
-		if ok {
-			initEther = amount
-		}
-		testUtils.TestServer(instanceAmount, conf.Node, conf.PrivateKey, initEther, 0, testRound)
-	default:
-		log.Fatal("unknown function", function)
+		testUtils.AddSink(sink)
+	}
+	if conf.BatchSize > 0 {
+		pool.EnableBatch(conf.BatchSize, time.Duration(conf.BatchFlushInterval)*time.Millisecond)
 	}
+	return &env{
+		conf:           conf,
+		pool:           pool,
+		client:         pool.Client(0),
+		txpoolInterval: txpoolInterval,
+	}, nil
 }
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/KSlashh/test-eth/log"
+)
+
+// Collector writes its metrics in prometheus text format.
+type Collector func(w io.Writer)
+
+var (
+	mu         sync.Mutex
+	collectors = map[string]Collector{}
+)
+
+// Register adds a collector to the metrics endpoint, registering the same name
+// again replaces the old collector.
+func Register(name string, c Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors[name] = c
+}
+
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(collectors, name)
+}
+
+// WriteAll writes the output of every registered collector to w.
+func WriteAll(w io.Writer) {
+	mu.Lock()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cs := make([]Collector, len(names))
+	for i, name := range names {
+		cs[i] = collectors[name]
+	}
+	mu.Unlock()
+	for _, c := range cs {
+		c(w)
+	}
+}
+
+// Serve exposes the registered collectors at http://addr/metrics.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteAll(w)
+	})
+	go func() {
+		log.Infof("Serving metrics at http://%s/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/KSlashh/test-eth/testUtils"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// printResult writes result to stdout as one json document with -output json,
+// otherwise it calls text, which prints the result for humans.
+func printResult(result interface{}, text func()) error {
+	if output != "json" {
+		text()
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// printView prints the block, tx and receipt views.
+func printView(view fmt.Stringer) error {
+	return printResult(view, func() { fmt.Print(view) })
+}
+
+// The results below are the json output of the query commands.
+
+type balanceResult struct {
+	Address     common.Address `json:"address"`
+	BlockNumber *uint64        `json:"blockNumber"` // null for latest
+	Balance     *units.Amount  `json:"balance"`     // wei
+	Ether       string         `json:"ether"`
+}
+
+type txCountResult struct {
+	BlockNumber uint64      `json:"blockNumber"`
+	BlockHash   common.Hash `json:"blockHash"`
+	TxCount     uint        `json:"txCount"`
+}
+
+type transferResult struct {
+	TxHash common.Hash    `json:"transactionHash"`
+	To     common.Address `json:"to"`
+	Amount *units.Amount  `json:"amount"` // wei
+}
+
+type validatorsResult struct {
+	StartHeight  uint64                 `json:"startHeight"`
+	EndHeight    uint64                 `json:"endHeight"`
+	Blocks       int                    `json:"blocks"`
+	Undecodable  int                    `json:"undecodableBlocks"`
+	RoundChanges int                    `json:"roundChanges"`
+	ExtraRounds  int                    `json:"extraRounds"`
+	Validators   []validatorSummaryJSON `json:"validators"`
+}
+
+type validatorSummaryJSON struct {
+	Address   common.Address `json:"address"`
+	Proposals int            `json:"proposals"`
+	Missed    int            `json:"missedProposals"`
+	Signed    int            `json:"committedSeals"`
+	Absent    int            `json:"absentSeals"`
+}
+
+func newValidatorsResult(stats *testUtils.ValidatorStats, start, end uint64) *validatorsResult {
+	res := &validatorsResult{
+		StartHeight:  start,
+		EndHeight:    end,
+		Blocks:       stats.Blocks,
+		Undecodable:  stats.Undecodable,
+		RoundChanges: stats.RoundChanges,
+		ExtraRounds:  stats.Rounds,
+		Validators:   []validatorSummaryJSON{},
+	}
+	for _, v := range stats.Summaries() {
+		res.Validators = append(res.Validators, validatorSummaryJSON(v))
+	}
+	return res
+}
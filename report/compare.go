@@ -0,0 +1,145 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// Thresholds of the regressions found by Compare, a negative value disables
+// the check.
+type Thresholds struct {
+	TpsDrop             float64 // percent of the baseline tps
+	LatencyIncrease     float64 // percent of the baseline p50, p90 and p99
+	FailureRateIncrease float64 // percentage points
+}
+
+// Row is one metric of every compared run. Changes are relative to the
+// baseline in percent, or in percentage points for a metric in "%".
+type Row struct {
+	Metric    string    `json:"metric"`
+	Unit      string    `json:"unit"`
+	Values    []float64 `json:"values"`
+	Changes   []float64 `json:"changes"`
+	Regressed []bool    `json:"regressed"`
+}
+
+// Comparison of runs against the first one, the baseline.
+type Comparison struct {
+	Files       []string `json:"files"`
+	Rows        []Row    `json:"rows"`
+	Regressions []string `json:"regressions"`
+}
+
+type metric struct {
+	name  string
+	unit  string
+	value func(m Metrics) float64
+	// regressed tells if change is a regression, nil for metrics not gated
+	regressed func(change float64, t Thresholds) bool
+}
+
+var metrics = []metric{
+	{"Tps", "txns/s", func(m Metrics) float64 { return m.Tps },
+		func(c float64, t Thresholds) bool { return t.TpsDrop >= 0 && -c > t.TpsDrop }},
+	{"Latency p50", "ms", func(m Metrics) float64 { return float64(m.LatencyP50) }, latencyRegressed},
+	{"Latency p90", "ms", func(m Metrics) float64 { return float64(m.LatencyP90) }, latencyRegressed},
+	{"Latency p99", "ms", func(m Metrics) float64 { return float64(m.LatencyP99) }, latencyRegressed},
+	{"Latency max", "ms", func(m Metrics) float64 { return float64(m.LatencyMax) }, nil},
+	{"Failure rate", "%", func(m Metrics) float64 { return m.FailureRate() },
+		func(c float64, t Thresholds) bool { return t.FailureRateIncrease >= 0 && c > t.FailureRateIncrease }},
+	{"Rpc errors", "", func(m Metrics) float64 { return float64(m.RPCErrors) }, nil},
+	{"Succeeded txns", "", func(m Metrics) float64 { return float64(m.Succeeded) }, nil},
+}
+
+func latencyRegressed(c float64, t Thresholds) bool {
+	return t.LatencyIncrease >= 0 && c > t.LatencyIncrease
+}
+
+func percentChange(base, v float64) float64 {
+	if base == 0 {
+		if v == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (v - base) * 100 / base
+}
+
+// Compare compares every run with runs[0], files are their names.
+func Compare(files []string, runs []*Run, t Thresholds) *Comparison {
+	c := &Comparison{Files: files}
+	for _, m := range metrics {
+		row := Row{Metric: m.name, Unit: m.unit}
+		base := m.value(runs[0].Metrics)
+		for i, run := range runs {
+			v := m.value(run.Metrics)
+			change := percentChange(base, v)
+			if m.unit == "%" {
+				change = v - base
+			}
+			regressed := i > 0 && m.regressed != nil && m.regressed(change, t)
+			row.Values = append(row.Values, v)
+			row.Changes = append(row.Changes, change)
+			row.Regressed = append(row.Regressed, regressed)
+			if regressed {
+				c.Regressions = append(c.Regressions, fmt.Sprintf("%s: %s %s", files[i], m.name, formatChange(m.unit, change)))
+			}
+		}
+		c.Rows = append(c.Rows, row)
+	}
+	return c
+}
+
+// formatChange writes the change of a percentage in points.
+func formatChange(unit string, change float64) string {
+	if unit == "%" {
+		return fmt.Sprintf("%+.2f pt", change)
+	}
+	return fmt.Sprintf("%+.1f%%", change)
+}
+
+// String lays the comparison out as a table, regressions marked with "!".
+func (c *Comparison) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "Metric")
+	for _, f := range c.Files {
+		fmt.Fprintf(w, "\t%s", f)
+	}
+	fmt.Fprintln(w)
+	for _, row := range c.Rows {
+		name := row.Metric
+		if row.Unit != "" {
+			name += " (" + row.Unit + ")"
+		}
+		fmt.Fprint(w, name)
+		for i, v := range row.Values {
+			fmt.Fprintf(w, "\t%s", formatValue(v))
+			if i > 0 {
+				fmt.Fprintf(w, " (%s)", formatChange(row.Unit, row.Changes[i]))
+			}
+			if row.Regressed[i] {
+				fmt.Fprint(w, " !")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	if len(c.Regressions) == 0 {
+		b.WriteString("\nNo regression.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\n%d regression(s):\n", len(c.Regressions))
+	for _, r := range c.Regressions {
+		fmt.Fprintf(&b, "  %s\n", r)
+	}
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,232 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// chart size and margins, in svg pixels
+const (
+	chartWidth  = 760
+	chartHeight = 260
+	marginLeft  = 64
+	marginRight = 16
+	marginTop   = 28
+	marginBot   = 36
+	chartTicks  = 5
+)
+
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd"}
+
+type series struct {
+	name string
+	x, y []float64
+}
+
+// mark is a named vertical line of a chart, like the start of a phase.
+type mark struct {
+	name string
+	x    float64
+}
+
+type chart struct {
+	Title  string
+	xLabel string
+	series []series
+	marks  []mark
+}
+
+func (c *chart) add(name string, x, y []float64) {
+	if len(x) > 0 {
+		c.series = append(c.series, series{name, x, y})
+	}
+}
+
+func (c *chart) empty() bool {
+	return len(c.series) == 0
+}
+
+func bounds(c *chart) (x0, x1, y0, y1 float64) {
+	x0, x1 = math.Inf(1), math.Inf(-1)
+	for _, s := range c.series {
+		for i := range s.x {
+			x0, x1 = math.Min(x0, s.x[i]), math.Max(x1, s.x[i])
+			y1 = math.Max(y1, s.y[i])
+		}
+	}
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	return
+}
+
+func formatTick(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// SVG draws the chart as lines over a grid, without any script.
+func (c *chart) SVG() template.HTML {
+	x0, x1, y0, y1 := bounds(c)
+	w := float64(chartWidth - marginLeft - marginRight)
+	h := float64(chartHeight - marginTop - marginBot)
+	px := func(x float64) float64 { return marginLeft + (x-x0)/(x1-x0)*w }
+	py := func(y float64) float64 { return marginTop + h - (y-y0)/(y1-y0)*h }
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	for i := 0; i <= chartTicks; i++ {
+		y := y0 + (y1-y0)*float64(i)/chartTicks
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#ddd"/>`, marginLeft, chartWidth-marginRight, py(y), py(y))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" class="tick">%s</text>`, marginLeft-6, py(y)+4, formatTick(y))
+		x := x0 + (x1-x0)*float64(i)/chartTicks
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" class="tick">%s</text>`, px(x), chartHeight-marginBot+16, formatTick(x))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" class="tick">%s</text>`,
+		marginLeft+int(w)/2, chartHeight-4, html.EscapeString(c.xLabel))
+	for _, m := range c.marks {
+		if m.x < x0 || m.x > x1 {
+			continue
+		}
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" stroke="#888" stroke-dasharray="4 3"/>`, px(m.x), px(m.x), marginTop, marginTop+h)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="tick">%s</text>`, px(m.x)+3, marginTop+10, html.EscapeString(m.name))
+	}
+	for i, s := range c.series {
+		color := palette[i%len(palette)]
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, color)
+		for k := range s.x {
+			fmt.Fprintf(&b, "%.1f,%.1f ", px(s.x[k]), py(s.y[k]))
+		}
+		b.WriteString(`"/>`)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, marginLeft+8+i*130, 8, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" class="legend">%s</text>`, marginLeft+22+i*130, 17, html.EscapeString(s.name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// charts builds the charts of the data r has, the load-test series are
+// plotted against the seconds since the start of the run.
+func (r *Run) charts() []*chart {
+	since := func(sec float64) float64 { return sec - float64(r.Start.UnixNano())/1e9 }
+	tps := &chart{Title: "Throughput (txns/s)", xLabel: "second"}
+	latency := &chart{Title: "Confirm latency (ms)", xLabel: "second"}
+	failures := &chart{Title: "Failures per sample", xLabel: "second"}
+	interval := &chart{Title: "Block interval (s)", xLabel: "block"}
+	fill := &chart{Title: "Block fill (% of gas limit)", xLabel: "block"}
+
+	var t, confirmed, p50, p90, p99, failed, rpcErrors []float64
+	for _, s := range r.Samples {
+		t = append(t, since(float64(s.Time.UnixNano())/1e9))
+		confirmed = append(confirmed, s.Tps)
+		p50 = append(p50, float64(s.P50))
+		p90 = append(p90, float64(s.P90))
+		p99 = append(p99, float64(s.P99))
+		failed = append(failed, float64(s.Failed))
+		rpcErrors = append(rpcErrors, float64(s.RPCErrors))
+	}
+	var bt, btps, number, intervals, fills []float64
+	for _, b := range r.Blocks {
+		number = append(number, float64(b.Number))
+		intervals = append(intervals, float64(b.Interval))
+		fills = append(fills, b.Fill*100)
+		if b.Interval > 0 {
+			bt = append(bt, since(float64(b.Time)))
+			btps = append(btps, float64(b.Txns)/float64(b.Interval))
+		}
+	}
+	tps.add("confirmed", t, confirmed)
+	tps.add("on chain", bt, btps)
+	latency.add("p50", t, p50)
+	latency.add("p90", t, p90)
+	latency.add("p99", t, p99)
+	failures.add("failed txns", t, failed)
+	failures.add("rpc errors", t, rpcErrors)
+	interval.add("interval", number, intervals)
+	fill.add("fill", number, fills)
+	for _, p := range r.Phases {
+		m := mark{p.Name, since(float64(p.Start.UnixNano()) / 1e9)}
+		for _, c := range []*chart{tps, latency, failures} {
+			c.marks = append(c.marks, m)
+		}
+	}
+
+	var res []*chart
+	for _, c := range []*chart{tps, latency, interval, fill, failures} {
+		if !c.empty() {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(d time.Duration) time.Duration { return d.Round(time.Second) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Run.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+td, th { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #f4f4f4; }
+.tick { font-size: 11px; fill: #555; }
+.legend { font-size: 12px; fill: #222; }
+section { margin-bottom: 24px; }
+</style>
+</head>
+<body>
+<h1>{{.Run.Title}}</h1>
+<p>{{.Run.Start.Format "2006-01-02 15:04:05"}} to {{.Run.End.Format "2006-01-02 15:04:05"}}</p>
+<h2>Summary</h2>
+<table>
+{{range .Run.Summary}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{if .Run.Phases}}<h2>Phases</h2>
+<table>
+<tr><th>Phase</th><th>Workload</th><th>Instances</th><th>Measured</th><th>Duration</th><th>Tps</th><th>Submitted</th><th>Succeeded</th><th>Failed</th><th>Rpc errors</th><th>Latency p50/p90/p99/max</th></tr>
+{{range .Run.Phases}}<tr><td>{{.Name}}</td><td>{{.Workload}}</td><td>{{.Instances}}</td><td>{{if .Measured}}yes{{else}}no{{end}}</td><td>{{seconds .Duration}}</td><td>{{printf "%.2f" .Metrics.Tps}}</td><td>{{.Metrics.Submitted}}</td><td>{{.Metrics.Succeeded}}</td><td>{{.Metrics.Failed}}</td><td>{{.Metrics.RPCErrors}}</td><td>{{.Metrics.LatencyP50}}/{{.Metrics.LatencyP90}}/{{.Metrics.LatencyP99}}/{{.Metrics.LatencyMax}} ms</td></tr>
+{{end}}</table>
+{{end}}{{range .Charts}}<section>
+<h3>{{.Title}}</h3>
+{{.SVG}}
+</section>
+{{end}}<h2>Configuration</h2>
+<table>
+{{range .Run.Settings}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes r as a self-contained html page.
+func WriteHTML(w io.Writer, r *Run) error {
+	return page.Execute(w, struct {
+		Run    *Run
+		Charts []*chart
+	}{r, r.charts()})
+}
+
+func WriteHTMLFile(path string, r *Run) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteHTML(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,117 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Run is the structured data of one test run or recording.
+type Run struct {
+	Title    string    `json:"title"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Settings []Field   `json:"settings"` // the configuration of the run
+	Summary  []Field   `json:"summary"`  // the final data
+	Metrics  Metrics   `json:"metrics"`  // the final data compared between runs
+	Samples  []Sample  `json:"samples"`  // load-test time series, empty for a recording
+	Blocks   []Block   `json:"blocks"`
+	Phases   []Phase   `json:"phases"` // the phases of a campaign, empty for other runs
+}
+
+// Metrics are the final numbers of a run.
+type Metrics struct {
+	Tps        float64 `json:"tps"`
+	Submitted  int64   `json:"submitted"`
+	Succeeded  int64   `json:"succeeded"`
+	Failed     int64   `json:"failed"`
+	RPCErrors  int64   `json:"rpcErrors"`
+	LatencyP50 int64   `json:"latencyP50"` // confirm latency, millisecond
+	LatencyP90 int64   `json:"latencyP90"`
+	LatencyP99 int64   `json:"latencyP99"`
+	LatencyMax int64   `json:"latencyMax"`
+}
+
+// FailureRate is the percentage of the finished txns that failed.
+func (m Metrics) FailureRate() float64 {
+	if m.Succeeded+m.Failed == 0 {
+		return 0
+	}
+	return float64(m.Failed) * 100 / float64(m.Succeeded+m.Failed)
+}
+
+// Field is one row of a table of the report.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Sample is the load-test data of one sampling window ending at Time.
+type Sample struct {
+	Time      time.Time `json:"time"`
+	Tps       float64   `json:"tps"` // confirmed txns per second
+	P50       int64     `json:"p50"` // confirm latency, millisecond
+	P90       int64     `json:"p90"`
+	P99       int64     `json:"p99"`
+	Failed    int64     `json:"failed"`
+	RPCErrors int64     `json:"rpcErrors"`
+}
+
+// Phase is the data of one phase of a campaign, the Metrics of the run only
+// cover the measured ones.
+type Phase struct {
+	Name      string    `json:"name"`
+	Workload  string    `json:"workload"`
+	Instances int       `json:"instances"`
+	Measured  bool      `json:"measured"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Metrics   Metrics   `json:"metrics"`
+}
+
+func (p Phase) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// Block is one block of the run.
+type Block struct {
+	Number   uint64  `json:"number"`
+	Time     uint64  `json:"time"`     // header timestamp, second
+	Interval uint64  `json:"interval"` // second since the previous block
+	Txns     int     `json:"txns"`
+	Fill     float64 `json:"fill"` // gas used / gas limit
+}
+
+func New(title string, settings []Field) *Run {
+	return &Run{Title: title, Start: time.Now(), Settings: settings}
+}
+
+func (r *Run) AddSetting(name string, value interface{}) {
+	r.Settings = append(r.Settings, Field{name, fmt.Sprint(value)})
+}
+
+func (r *Run) AddSummary(name string, value interface{}) {
+	r.Summary = append(r.Summary, Field{name, fmt.Sprint(value)})
+}
+
+// WriteJSONFile saves r as a result file, read back by ReadJSONFile.
+func WriteJSONFile(path string, r *Run) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func ReadJSONFile(path string) (*Run, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Run)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
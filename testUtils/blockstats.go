@@ -0,0 +1,131 @@
+package testUtils
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var tpsWindowBlocks = 20
+var blockSummaryFrequency = 100 // blocks
+
+// BlockInfo is what Recorder2 keeps of every recorded block.
+type BlockInfo struct {
+	Number   uint64
+	Time     uint64 // header timestamp, second
+	Interval uint64 // second since the previous block
+	Txns     int
+	GasUsed  uint64
+	GasLimit uint64
+	Size     uint64 // byte
+}
+
+func NewBlockInfo(block *types.Block, parentTime uint64) BlockInfo {
+	return BlockInfo{
+		Number:   block.NumberU64(),
+		Time:     block.Time(),
+		Interval: block.Time() - parentTime,
+		Txns:     len(block.Transactions()),
+		GasUsed:  block.GasUsed(),
+		GasLimit: block.GasLimit(),
+		Size:     uint64(block.Size()),
+	}
+}
+
+func (b BlockInfo) Fill() float64 {
+	if b.GasLimit == 0 {
+		return 0
+	}
+	return float64(b.GasUsed) / float64(b.GasLimit)
+}
+
+// BlockStats accumulates per-block throughput data and keeps a sliding window
+// of the last tpsWindowBlocks blocks.
+type BlockStats struct {
+	Blocks      int
+	EmptyBlocks int
+	Txns        uint64
+	GasUsed     uint64
+	GasLimit    uint64
+	Size        uint64
+	Duration    uint64 // second
+	intervals   []uint64
+	window      []BlockInfo
+}
+
+func (s *BlockStats) Add(b BlockInfo) {
+	s.Blocks++
+	if b.Txns == 0 {
+		s.EmptyBlocks++
+	}
+	s.Txns += uint64(b.Txns)
+	s.GasUsed += b.GasUsed
+	s.GasLimit += b.GasLimit
+	s.Size += b.Size
+	s.Duration += b.Interval
+	s.intervals = append(s.intervals, b.Interval)
+	s.window = append(s.window, b)
+	if len(s.window) > tpsWindowBlocks {
+		s.window = s.window[1:]
+	}
+}
+
+func perSecond(n uint64, seconds uint64) float64 {
+	if seconds == 0 {
+		return 0
+	}
+	return float64(n) / float64(seconds)
+}
+
+func (s *BlockStats) Tps() float64 {
+	return perSecond(s.Txns, s.Duration)
+}
+
+func (s *BlockStats) GasPerSecond() float64 {
+	return perSecond(s.GasUsed, s.Duration)
+}
+
+// WindowTps is the tps over the last tpsWindowBlocks blocks.
+func (s *BlockStats) WindowTps() float64 {
+	var txns, duration uint64
+	for _, b := range s.window {
+		txns += uint64(b.Txns)
+		duration += b.Interval
+	}
+	return perSecond(txns, duration)
+}
+
+func (s *BlockStats) Fill() float64 {
+	if s.GasLimit == 0 {
+		return 0
+	}
+	return float64(s.GasUsed) / float64(s.GasLimit)
+}
+
+func (s *BlockStats) EmptyRatio() float64 {
+	if s.Blocks == 0 {
+		return 0
+	}
+	return float64(s.EmptyBlocks) / float64(s.Blocks)
+}
+
+func (s *BlockStats) AverageSize() uint64 {
+	if s.Blocks == 0 {
+		return 0
+	}
+	return s.Size / uint64(s.Blocks)
+}
+
+// IntervalQuantile returns the q quantile of the block intervals in second.
+func (s *BlockStats) IntervalQuantile(q float64) uint64 {
+	if len(s.intervals) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), s.intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(q * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,122 @@
+package testUtils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/config"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/units"
+)
+
+// campaignInstances is the number of account pairs of a campaign, the most
+// any transfer phase uses.
+func campaignInstances(phases []config.Phase) int {
+	n := 0
+	for _, p := range phases {
+		if p.Instances > n {
+			n = p.Instances
+		}
+	}
+	return n
+}
+
+// phaseWorkload is the workload of one phase on the account pairs of the
+// campaign. A transfer phase funds the pairs no fund phase did.
+func phaseWorkload(p config.Phase, pool *api.ClientPool, mainPrivateKeyHex string, initEther *units.Amount, pairs []*pair, events *EventStream) Workload {
+	switch p.Workload {
+	case "fund":
+		return func(ctrl *RunController, index int) {
+			// fundPair logs why a pair stays unfunded, the transfer phase
+			// funds it again
+			if pairs[index] == nil {
+				pairs[index], _ = fundPair(ctrl.Context(), pool, index, mainPrivateKeyHex, initEther)
+			}
+		}
+	case "transfer":
+		return func(ctrl *RunController, index int) {
+			if pairs[index] == nil {
+				p, err := fundPair(ctrl.Context(), pool, index, mainPrivateKeyHex, initEther)
+				if err != nil {
+					return
+				}
+				pairs[index] = p
+			}
+			events.Emit(InstanceStarted{Instance: index, Time: time.Now()})
+			defer func() {
+				events.Emit(InstanceStopped{Instance: index, Time: time.Now()})
+			}()
+			transferRounds(ctrl, pool, index, pairs[index], events)
+		}
+	default:
+		return func(ctrl *RunController, index int) {
+			<-ctrl.Done()
+		}
+	}
+}
+
+// RunCampaign runs phases one after the other on the same account pairs.
+// Every phase starts once all instances of the previous one returned, and only
+// the events of the measured phases count toward the metrics of the report and
+// the SLOs. It returns the error of the SLOs that failed.
+func RunCampaign(ctx context.Context, pool *api.ClientPool, privateKeyHex string, initEther *units.Amount, phases []config.Phase) error {
+	if len(phases) == 0 {
+		return fmt.Errorf("no phase configured")
+	}
+	instances := campaignInstances(phases)
+	client := pool.Client(0)
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	startHeight := header.Number
+	campaign := NewRunController(ctx, StopConditions{})
+	run := newRun("Load test campaign")
+	slo := newSLOSink(campaign, run, client)
+	events := NewEventStream(10000*(instances+1), runSinks(campaign, pool, run, slo, true)...)
+	log.Infof("Start campaign of %d phases with %d instances. Start at block %s.", len(phases), instances, startHeight.String())
+	pairs := make([]*pair, instances)
+	for i, p := range phases {
+		if campaign.Context().Err() != nil {
+			break
+		}
+		cond := StopConditions{
+			Duration:  time.Duration(p.Duration) * time.Second,
+			TotalTxns: p.Txns,
+			Rounds:    p.Rounds,
+		}
+		n := p.Instances
+		switch p.Workload {
+		case "fund":
+			n = instances
+		case "idle":
+			n = 0
+		}
+		log.Infof("Start phase %d/%d %s: %s workload, %d instances, measured %t, %s.", i+1, len(phases), p.Name, p.Workload, n, p.Measure, cond)
+		events.Emit(PhaseStarted{Phase: p.Name, Workload: p.Workload, Instances: n, Measured: p.Measure, Time: time.Now()})
+		ctrl := NewRunController(campaign.Context(), cond)
+		if n == 0 {
+			// an idle phase only waits for its duration
+			n = 1
+		}
+		ctrl.Run(n, phaseWorkload(p, pool, privateKeyHex, initEther, pairs, events))
+		log.Infof("Done phase %s (%s). Sent-Txns: %d, Failed-Txns: %d", p.Name, ctrl.StopReason(), ctrl.SentTxns(), ctrl.FailedTxns())
+	}
+	campaign.Stop("all phases done")
+	events.Close()
+	header, err = client.HeaderByNumber(context.Background(), nil)
+	if err == nil {
+		log.Infof("Done campaign (%s). Started at block %s, end at block %s.", campaign.StopReason(), startHeight.String(), header.Number.String())
+	}
+	if run != nil {
+		finishRun(client, run, campaign, startHeight, header)
+	}
+	pool.Report()
+	api.Stats.Report()
+	if slo != nil {
+		return slo.Err()
+	}
+	return nil
+}
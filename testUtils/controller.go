@@ -0,0 +1,170 @@
+package testUtils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KSlashh/test-eth/log"
+)
+
+// StopConditions of a test run, a zero value means no limit. The run stops as
+// soon as the first of them is hit.
+type StopConditions struct {
+	Duration    time.Duration
+	TotalTxns   int64 // txns sent by all instances together
+	Rounds      int   // rounds per instance
+	ErrorBudget int64 // failed txns tolerated, the run stops at ErrorBudget+1
+}
+
+func (c StopConditions) String() string {
+	return fmt.Sprintf("duration %s, total txns %d, rounds %d, error budget %d",
+		c.Duration, c.TotalTxns, c.Rounds, c.ErrorBudget)
+}
+
+// Workload is run by the controller once per instance and should return when
+// the controller tells it to stop.
+type Workload func(ctrl *RunController, index int)
+
+// RunController owns the stop conditions of a test run. Workloads reserve
+// every tx with TakeTx, report its outcome with TxDone and stop sending once
+// Done is closed.
+type RunController struct {
+	// accessed atomically, keep 64-bit aligned
+	taken  int64
+	failed int64
+
+	cond   StopConditions
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  time.Time
+
+	mu     sync.Mutex
+	reason string
+}
+
+func NewRunController(ctx context.Context, cond StopConditions) *RunController {
+	c := &RunController{cond: cond, start: time.Now()}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	if cond.Duration > 0 {
+		timer := time.AfterFunc(cond.Duration, func() {
+			c.Stop("duration reached")
+		})
+		go func() {
+			<-c.ctx.Done()
+			timer.Stop()
+		}()
+	}
+	go func() {
+		<-c.ctx.Done()
+		c.Stop("interrupted")
+	}()
+	return c
+}
+
+// Context is done once the run should stop sending.
+func (c *RunController) Context() context.Context {
+	return c.ctx
+}
+
+func (c *RunController) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Stop ends the run, only the first reason is kept.
+func (c *RunController) Stop(reason string) {
+	c.setReason(reason)
+	c.cancel()
+}
+
+func (c *RunController) setReason(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reason == "" {
+		c.reason = reason
+		log.Infof("Stop test: %s", reason)
+	}
+}
+
+func (c *RunController) StopReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+func (c *RunController) StartTime() time.Time {
+	return c.start
+}
+
+// Continue reports whether an instance may start round (counted from 0).
+func (c *RunController) Continue(round int) bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	if c.cond.Rounds > 0 && round >= c.cond.Rounds {
+		return false
+	}
+	return true
+}
+
+// TakeTx reserves one tx of the TotalTxns budget, it returns false when the
+// run is stopped or the budget is used up. Running out of budget does not
+// cancel the context, so that txns already reserved can still be sent, and
+// the run ends when every instance has returned.
+func (c *RunController) TakeTx() bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	n := atomic.AddInt64(&c.taken, 1)
+	if c.cond.TotalTxns > 0 && n > c.cond.TotalTxns {
+		atomic.AddInt64(&c.taken, -1)
+		c.setReason("total txns reached")
+		return false
+	}
+	return true
+}
+
+// ReleaseTx gives back a reservation whose tx could not be sent.
+func (c *RunController) ReleaseTx() {
+	atomic.AddInt64(&c.taken, -1)
+}
+
+// TxDone records the outcome of a sent tx and stops the run once the error
+// budget is exceeded.
+func (c *RunController) TxDone(success bool) {
+	if success {
+		return
+	}
+	n := atomic.AddInt64(&c.failed, 1)
+	if c.cond.ErrorBudget > 0 && n > c.cond.ErrorBudget {
+		c.Stop("error budget exhausted")
+	}
+}
+
+func (c *RunController) SentTxns() int64 {
+	return atomic.LoadInt64(&c.taken)
+}
+
+func (c *RunController) FailedTxns() int64 {
+	return atomic.LoadInt64(&c.failed)
+}
+
+// Run starts numOfInstance copies of w and waits for all of them to return.
+func (c *RunController) Run(numOfInstance int, w Workload) {
+	wg := new(sync.WaitGroup)
+	for i := 0; i < numOfInstance; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			w(c, index)
+		}(i)
+	}
+	wg.Wait()
+	if c.cond.Rounds > 0 {
+		c.Stop("rounds reached")
+	} else {
+		c.Stop("all instances done")
+	}
+}
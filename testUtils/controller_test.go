@@ -0,0 +1,212 @@
+package testUtils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/local"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var testChain *local.Chain
+
+func TestMain(m *testing.M) {
+	// seal a block as soon as a tx is pending
+	chain, err := local.Start("127.0.0.1:0", 0)
+	if err != nil {
+		panic(err)
+	}
+	testChain = chain
+	checkTxComfirmFrequency = time.Millisecond * 20
+	code := m.Run()
+	chain.Close()
+	os.Exit(code)
+}
+
+// countSink counts the txns included and refused.
+type countSink struct {
+	mu       sync.Mutex
+	included int
+	refused  int
+}
+
+func (s *countSink) Handle(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch e := e.(type) {
+	case TxIncluded:
+		s.included++
+	case RPCError:
+		if e.Method == transferMethod {
+			s.refused++
+		}
+	}
+}
+
+func (s *countSink) Close() {}
+
+func testPool(t *testing.T) *api.ClientPool {
+	pool, err := api.NewClientPool([]string{testChain.URL()}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// fundedPairs funds the pairs of n instances from the admin account.
+func fundedPairs(t *testing.T, pool *api.ClientPool, n int) []*pair {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	pairs, err := fundPairs(ctx, pool, testChain.PrivateKey(), units.NewAmountOf(1, units.Ether), 0, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pairs
+}
+
+// emptyPair is a pair of accounts without funds, the node refuses their txns.
+func emptyPair(t *testing.T) *pair {
+	p := new(pair)
+	for _, a := range []struct{ sk, pk *string }{{&p.skA, &p.pkA}, {&p.skB, &p.pkB}} {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		*a.sk = hexutil.Encode(crypto.FromECDSA(key))[2:]
+		*a.pk = crypto.PubkeyToAddress(*key.Public().(*ecdsa.PublicKey)).Hex()
+	}
+	return p
+}
+
+// runTransfers runs a transferInstance per pair until cond is met.
+func runTransfers(pool *api.ClientPool, pairs []*pair, cond StopConditions) (*RunController, *countSink) {
+	sink := new(countSink)
+	events := NewEventStream(1000, sink)
+	ctrl := NewRunController(context.Background(), cond)
+	ctrl.Run(len(pairs), transferInstance(pool, pairs, 0, events))
+	events.Close()
+	return ctrl, sink
+}
+
+func TestStopOnDuration(t *testing.T) {
+	pool := testPool(t)
+	pairs := fundedPairs(t, pool, 2)
+	start := time.Now()
+	ctrl, sink := runTransfers(pool, pairs, StopConditions{Duration: time.Second})
+	if reason := ctrl.StopReason(); reason != "duration reached" {
+		t.Errorf("stop reason %q, want duration reached", reason)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*10 {
+		t.Errorf("run took %s", elapsed)
+	}
+	if sink.included == 0 {
+		t.Error("no tx included within the duration")
+	}
+}
+
+func TestStopOnTotalTxns(t *testing.T) {
+	pool := testPool(t)
+	pairs := fundedPairs(t, pool, 2)
+	ctrl, sink := runTransfers(pool, pairs, StopConditions{TotalTxns: 7})
+	if reason := ctrl.StopReason(); reason != "total txns reached" {
+		t.Errorf("stop reason %q, want total txns reached", reason)
+	}
+	if ctrl.SentTxns() != 7 || sink.included != 7 {
+		t.Errorf("sent %d and included %d txns, want 7", ctrl.SentTxns(), sink.included)
+	}
+}
+
+func TestStopOnRounds(t *testing.T) {
+	pool := testPool(t)
+	pairs := fundedPairs(t, pool, 2)
+	ctrl, sink := runTransfers(pool, pairs, StopConditions{Rounds: 3})
+	if reason := ctrl.StopReason(); reason != "rounds reached" {
+		t.Errorf("stop reason %q, want rounds reached", reason)
+	}
+	// 2 instances, 3 rounds of 2 txns
+	if sink.included != 12 {
+		t.Errorf("included %d txns, want 12", sink.included)
+	}
+}
+
+func TestStopOnErrorBudget(t *testing.T) {
+	pool := testPool(t)
+	ctrl, sink := runTransfers(pool, []*pair{emptyPair(t)}, StopConditions{Duration: time.Minute, ErrorBudget: 3})
+	if reason := ctrl.StopReason(); reason != "error budget exhausted" {
+		t.Errorf("stop reason %q, want error budget exhausted", reason)
+	}
+	if ctrl.FailedTxns() != 4 || sink.refused != 4 {
+		t.Errorf("failed %d and refused %d txns, want 4", ctrl.FailedTxns(), sink.refused)
+	}
+}
+
+func TestStopOnFirstCondition(t *testing.T) {
+	pool := testPool(t)
+	pairs := fundedPairs(t, pool, 2)
+	cases := []struct {
+		cond   StopConditions
+		reason string
+	}{
+		{StopConditions{Duration: time.Minute, TotalTxns: 5, Rounds: 100}, "total txns reached"},
+		{StopConditions{Duration: time.Minute, TotalTxns: 100, Rounds: 1}, "rounds reached"},
+		{StopConditions{Duration: time.Second, TotalTxns: 100000, Rounds: 100000}, "duration reached"},
+	}
+	for _, c := range cases {
+		ctrl, _ := runTransfers(pool, pairs, c.cond)
+		if reason := ctrl.StopReason(); reason != c.reason {
+			t.Errorf("%s: stop reason %q, want %s", c.cond, reason, c.reason)
+		}
+	}
+}
+
+func TestBatchedTransfers(t *testing.T) {
+	pool := testPool(t)
+	// sends, nonce and receipt lookups all go through the batcher
+	pool.EnableBatch(10, time.Millisecond*10)
+	pairs := fundedPairs(t, pool, 2)
+	ctrl, sink := runTransfers(pool, pairs, StopConditions{Rounds: 2})
+	if reason := ctrl.StopReason(); reason != "rounds reached" {
+		t.Errorf("stop reason %q, want rounds reached", reason)
+	}
+	if sink.included != 8 {
+		t.Errorf("included %d txns, want 8", sink.included)
+	}
+}
+
+func TestFundFromEmptyAdmin(t *testing.T) {
+	pool := testPool(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	// a refusal for insufficient funds is not retried
+	admin := emptyPair(t).skA
+	start := time.Now()
+	_, err := fundPairs(ctx, pool, admin, units.NewAmountOf(1, units.Ether), 0, 2)
+	if err == nil || !strings.Contains(err.Error(), "insufficient funds") {
+		t.Errorf("funding from an empty admin: %v, want insufficient funds", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Errorf("funding gave up after %s", elapsed)
+	}
+}
+
+func TestPipelineRounds(t *testing.T) {
+	pool := testPool(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	err := TestServer2(ctx, 2, pool, testChain.PrivateKey(), units.NewAmountOf(1, units.Ether), StopConditions{Rounds: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the pipeline did not stop after its rounds")
+	}
+}
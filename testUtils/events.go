@@ -0,0 +1,217 @@
+package testUtils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Event is one piece of load-test telemetry, see the types below.
+type Event interface {
+	EventTime() time.Time
+}
+
+type InstanceStarted struct {
+	Instance int
+	Time     time.Time
+}
+
+type InstanceStopped struct {
+	Instance int
+	Time     time.Time
+}
+
+type TxSubmitted struct {
+	Instance int
+	Hash     common.Hash
+	Time     time.Time
+}
+
+// TxIncluded is emitted once a tx is found in a block. SubmitTime is when it
+// was sent, AckTime when the node accepted it, IncludeTime the timestamp of
+// the including block and ObserveTime when we saw its receipt.
+type TxIncluded struct {
+	Instance    int
+	Hash        common.Hash
+	BlockNumber uint64
+	GasUsed     uint64
+	Success     bool // receipt status
+	SubmitTime  time.Time
+	AckTime     time.Time
+	IncludeTime time.Time
+	ObserveTime time.Time
+}
+
+// TxFailed is a tx that was sent but reverted or could not be confirmed.
+type TxFailed struct {
+	Instance int
+	Hash     common.Hash
+	Reason   string
+	Time     time.Time
+}
+
+type RPCError struct {
+	Instance int
+	Method   string
+	Err      string
+	Time     time.Time
+}
+
+// PhaseStarted is emitted between the phases of a campaign, once every event
+// of the previous phase is emitted. Only the events of measured phases count
+// toward the metrics.
+type PhaseStarted struct {
+	Phase     string
+	Workload  string
+	Instances int
+	Measured  bool
+	Time      time.Time
+}
+
+func (e InstanceStarted) EventTime() time.Time { return e.Time }
+func (e InstanceStopped) EventTime() time.Time { return e.Time }
+func (e TxSubmitted) EventTime() time.Time     { return e.Time }
+func (e TxIncluded) EventTime() time.Time      { return e.ObserveTime }
+func (e TxFailed) EventTime() time.Time        { return e.Time }
+func (e RPCError) EventTime() time.Time        { return e.Time }
+func (e PhaseStarted) EventTime() time.Time    { return e.Time }
+
+// ConfirmTime is the time from sending the tx to observing its receipt.
+func (e TxIncluded) ConfirmTime() time.Duration {
+	return e.ObserveTime.Sub(e.SubmitTime)
+}
+
+// Sink consumes the event stream. Handle is called from a single goroutine,
+// Close once the stream has ended.
+type Sink interface {
+	Handle(e Event)
+	Close()
+}
+
+// EventStream fans the events emitted by all instances out to its sinks.
+type EventStream struct {
+	ch    chan Event
+	sinks []Sink
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewEventStream(buffer int, sinks ...Sink) *EventStream {
+	s := &EventStream{
+		ch:    make(chan Event, buffer),
+		sinks: sinks,
+		done:  make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *EventStream) loop() {
+	for e := range s.ch {
+		for _, sink := range s.sinks {
+			sink.Handle(e)
+		}
+	}
+	for _, sink := range s.sinks {
+		sink.Close()
+	}
+	close(s.done)
+}
+
+// Emit must not be called after Close.
+func (s *EventStream) Emit(e Event) {
+	s.ch <- e
+}
+
+// Close ends the stream and waits for every sink to be closed.
+func (s *EventStream) Close() {
+	s.once.Do(func() {
+		close(s.ch)
+	})
+	<-s.done
+}
+
+// extraSinks are the sinks added with AddSink, the next run takes them.
+var extraSinks = struct {
+	sync.Mutex
+	sinks []Sink
+}{}
+
+// AddSink subscribes s to the event stream of the next test run only, the
+// stream closes s when that run ends.
+func AddSink(s Sink) {
+	extraSinks.Lock()
+	extraSinks.sinks = append(extraSinks.sinks, s)
+	extraSinks.Unlock()
+}
+
+// takeSinks returns the sinks added with AddSink and forgets them, so that a
+// sink closed by one run is not attached to the next.
+func takeSinks() []Sink {
+	extraSinks.Lock()
+	defer extraSinks.Unlock()
+	sinks := extraSinks.sinks
+	extraSinks.sinks = nil
+	return sinks
+}
+
+// MarshalEvent encodes e with its type name as {"Type": ..., "Event": ...},
+// like the lines FileSink writes.
+func MarshalEvent(e Event) ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string
+		Event Event
+	}{eventName(e), e})
+}
+
+// UnmarshalEvent decodes an event encoded by MarshalEvent.
+func UnmarshalEvent(data []byte) (Event, error) {
+	var env struct {
+		Type  string
+		Event json.RawMessage
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	var e Event
+	var err error
+	switch env.Type {
+	case "InstanceStarted":
+		var v InstanceStarted
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "InstanceStopped":
+		var v InstanceStopped
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "TxSubmitted":
+		var v TxSubmitted
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "TxIncluded":
+		var v TxIncluded
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "TxFailed":
+		var v TxFailed
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "RPCError":
+		var v RPCError
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	case "PhaseStarted":
+		var v PhaseStarted
+		err = json.Unmarshal(env.Event, &v)
+		e = v
+	default:
+		return nil, fmt.Errorf("unknown event type %q", env.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", env.Type, err)
+	}
+	return e, nil
+}
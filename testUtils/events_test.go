@@ -0,0 +1,29 @@
+package testUtils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAddSinkNextRunOnly(t *testing.T) {
+	pool := testPool(t)
+	sink := new(countSink)
+	AddSink(sink)
+	ctrl := NewRunController(context.Background(), StopConditions{})
+	defer ctrl.Stop("test done")
+	has := func(sinks []Sink) bool {
+		for _, s := range sinks {
+			if s == sink {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(runSinks(ctrl, pool, nil, nil, true)) {
+		t.Error("the added sink is not attached to the next run")
+	}
+	// the first run closed it with its stream
+	if has(runSinks(ctrl, pool, nil, nil, true)) {
+		t.Error("the added sink is attached to a second run")
+	}
+}
@@ -0,0 +1,87 @@
+package testUtils
+
+import (
+	"sort"
+	"time"
+)
+
+// Latency stages of a tracked tx:
+//
+//	submit:    sent --> node acknowledged eth_sendRawTransaction
+//	inclusion: acknowledged --> timestamp of the including block (txpool wait and block production)
+//	observe:   block timestamp --> we saw the receipt (block propagation and our polling)
+//
+// Block timestamps only have second precision, so inclusion and observe are
+// coarse and negative values are clamped to 0. Zion blocks are final once
+// included, so inclusion is also the finality latency.
+const (
+	SubmitStage = iota
+	InclusionStage
+	ObserveStage
+	TotalStage
+	numStages
+)
+
+var stageNames = [numStages]string{"Submit", "Inclusion", "Observe", "Total"}
+
+type LatencyBreakdown [numStages]time.Duration
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (e TxIncluded) Breakdown() LatencyBreakdown {
+	var b LatencyBreakdown
+	b[SubmitStage] = nonNegative(e.AckTime.Sub(e.SubmitTime))
+	b[InclusionStage] = nonNegative(e.IncludeTime.Sub(e.AckTime))
+	b[ObserveStage] = nonNegative(e.ObserveTime.Sub(e.IncludeTime))
+	b[TotalStage] = nonNegative(e.ObserveTime.Sub(e.SubmitTime))
+	return b
+}
+
+// LatencyStats keeps the millisecond samples of every stage.
+type LatencyStats struct {
+	samples [numStages][]int64
+}
+
+func (s *LatencyStats) Add(b LatencyBreakdown) {
+	for i, d := range b {
+		s.samples[i] = append(s.samples[i], d.Milliseconds())
+	}
+}
+
+func (s *LatencyStats) Count() int {
+	return len(s.samples[TotalStage])
+}
+
+func (s *LatencyStats) Average(stage int) int64 {
+	if len(s.samples[stage]) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, v := range s.samples[stage] {
+		sum += v
+	}
+	return sum / int64(len(s.samples[stage]))
+}
+
+// Quantiles returns the qs quantiles of stage in millisecond.
+func (s *LatencyStats) Quantiles(stage int, qs ...float64) []int64 {
+	res := make([]int64, len(qs))
+	if len(s.samples[stage]) == 0 {
+		return res
+	}
+	sorted := append([]int64(nil), s.samples[stage]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for k, q := range qs {
+		i := int(q * float64(len(sorted)))
+		if i >= len(sorted) {
+			i = len(sorted) - 1
+		}
+		res[k] = sorted[i]
+	}
+	return res
+}
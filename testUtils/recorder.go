@@ -0,0 +1,241 @@
+package testUtils
+
+import (
+	"time"
+
+	"github.com/KSlashh/test-eth/log"
+)
+
+var recorderLog = log.Module("recorder")
+
+// recordData is the statistics of one reporting window.
+type recordData struct {
+	submitted int64
+	goodTx    int64
+	badTx     int64
+	rpcErrors int64
+	totalCost int64 // millisecond
+	latency   LatencyStats
+}
+
+// add counts the tx and rpc events.
+func (d *recordData) add(e Event) {
+	switch e := e.(type) {
+	case TxSubmitted:
+		d.submitted++
+	case TxIncluded:
+		if !e.Success {
+			d.badTx++
+			break
+		}
+		d.latency.Add(e.Breakdown())
+		d.goodTx++
+		d.totalCost += e.ConfirmTime().Milliseconds()
+	case TxFailed:
+		d.badTx++
+	case RPCError:
+		d.rpcErrors++
+	}
+}
+
+func (d recordData) averageCost() int64 {
+	if d.goodTx == 0 {
+		return 0
+	}
+	return d.totalCost / d.goodTx
+}
+
+// Recorder is the Sink printing load-test statistics, the data since the last
+// record every recordFrequency, the total data every totalDataRecordFrequency
+// and once more when the stream is closed. In a campaign the data since the
+// last record covers every phase, the total only the measured ones, and the
+// data of each phase is printed when it ends.
+type Recorder struct {
+	total        recordData
+	tmp          recordData
+	liveInstance int
+	deadInstance int
+	start        time.Time
+	timeCache    time.Time
+	timeCache2   time.Time
+
+	phase     *PhaseStarted // nil outside of campaigns
+	phaseData recordData
+	phases    []phaseRecord // the phases done
+	measured  time.Duration // of the phases done
+}
+
+// phaseRecord is the data of one phase of a campaign.
+type phaseRecord struct {
+	name     string
+	measured bool
+	duration time.Duration
+	data     recordData
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		start:      time.Now(),
+		timeCache:  time.Now(),
+		timeCache2: time.Now(),
+	}
+}
+
+func (r *Recorder) Handle(e Event) {
+	switch e := e.(type) {
+	case InstanceStarted:
+		r.liveInstance += 1
+	case InstanceStopped:
+		r.liveInstance -= 1
+		r.deadInstance += 1
+	case PhaseStarted:
+		r.endPhase(e.Time)
+		r.phase = &e
+		return
+	}
+	if r.phase == nil || r.phase.Measured {
+		r.total.add(e)
+	}
+	if r.phase != nil {
+		r.phaseData.add(e)
+	}
+	r.tmp.add(e)
+	if (r.total.goodTx > 0 || r.total.submitted > 0) &&
+		time.Since(r.timeCache2).Seconds() >= totalDataRecordFrequency {
+		r.logTotal()
+		r.timeCache2 = time.Now()
+	}
+	if r.tmp.goodTx == 0 && r.tmp.submitted == 0 {
+		return
+	}
+	if time.Since(r.timeCache).Seconds() >= recordFrequency {
+		recorderLog.Infof("Data since last record: "+
+			"Last-record-time: %s, "+
+			"Duration: %f s, "+
+			"Submitted-Txns: %d, "+
+			"Succeed-Txns: %d, "+
+			"Failed-Txns: %d, "+
+			"Rpc-Errors: %d, "+
+			"Running-Instance: %d, "+
+			"Dead-Instance: %d, "+
+			"Average-Comfirm-timeCost: %d ms, "+
+			"Tps: %f",
+			r.timeCache.Format("2006-01-02_15:04:05"),
+			time.Since(r.timeCache).Seconds(),
+			r.tmp.submitted,
+			r.tmp.goodTx,
+			r.tmp.badTx,
+			r.tmp.rpcErrors,
+			r.liveInstance,
+			r.deadInstance,
+			r.tmp.averageCost(),
+			float64(r.tmp.goodTx)/(time.Since(r.timeCache).Seconds()),
+		)
+		if r.tmp.latency.Count() > 0 {
+			recorderLog.Infof("Average latency since last record: "+
+				"Submit: %d ms, "+
+				"Inclusion: %d ms, "+
+				"Observe: %d ms, "+
+				"Total: %d ms",
+				r.tmp.latency.Average(SubmitStage),
+				r.tmp.latency.Average(InclusionStage),
+				r.tmp.latency.Average(ObserveStage),
+				r.tmp.latency.Average(TotalStage),
+			)
+		}
+		r.tmp = recordData{}
+		r.timeCache = time.Now()
+	}
+}
+
+func (r *Recorder) Close() {
+	r.endPhase(time.Now())
+	r.logTotal()
+	r.logLatency()
+}
+
+// endPhase prints the data of the current phase.
+func (r *Recorder) endPhase(end time.Time) {
+	if r.phase == nil {
+		return
+	}
+	duration := end.Sub(r.phase.Time)
+	if r.phase.Measured {
+		r.measured += duration
+	}
+	measured := "unmeasured"
+	if r.phase.Measured {
+		measured = "measured"
+	}
+	r.logData("Phase "+r.phase.Phase+" ("+measured+")", r.phase.Time, duration, r.phaseData)
+	r.phases = append(r.phases, phaseRecord{r.phase.Phase, r.phase.Measured, duration, r.phaseData})
+	r.phase = nil
+	r.phaseData = recordData{}
+}
+
+// duration is the time the total data covers, in a campaign that of the
+// measured phases.
+func (r *Recorder) duration() time.Duration {
+	if r.phase == nil && len(r.phases) == 0 {
+		return time.Since(r.start)
+	}
+	d := r.measured
+	if r.phase != nil && r.phase.Measured {
+		d += time.Since(r.phase.Time)
+	}
+	return d
+}
+
+// logLatency prints the latency of every stage of the txns included so far.
+func (r *Recorder) logLatency() {
+	if r.total.latency.Count() == 0 {
+		return
+	}
+	for stage, name := range stageNames {
+		q := r.total.latency.Quantiles(stage, 0.5, 0.9, 0.99, 1)
+		recorderLog.Infof("——————————%s latency: "+
+			"Average: %d ms, "+
+			"P50: %d ms, "+
+			"P90: %d ms, "+
+			"P99: %d ms, "+
+			"Max: %d ms",
+			name,
+			r.total.latency.Average(stage),
+			q[0], q[1], q[2], q[3],
+		)
+	}
+}
+
+func (r *Recorder) logTotal() {
+	r.logData("ToTal", r.start, r.duration(), r.total)
+}
+
+func (r *Recorder) logData(name string, start time.Time, duration time.Duration, d recordData) {
+	tps := 0.0
+	if duration > 0 {
+		tps = float64(d.goodTx) / duration.Seconds()
+	}
+	recorderLog.Infof("——————————%s data: "+
+		"Start-time: %s, "+
+		"Duration: %f s, "+
+		"Submitted-Txns: %d, "+
+		"Succeed-Txns: %d, "+
+		"Failed-Txns: %d, "+
+		"Rpc-Errors: %d, "+
+		"Running-Instance: %d, "+
+		"Dead-Instance: %d, "+
+		"Average-Comfirm-timeCost: %d ms, "+
+		"Tps: %f",
+		name,
+		start.Format("2006-01-02_15:04:05"),
+		duration.Seconds(),
+		d.submitted,
+		d.goodTx,
+		d.badTx,
+		d.rpcErrors,
+		r.liveInstance,
+		r.deadInstance,
+		d.averageCost(),
+		tps,
+	)
+}
@@ -0,0 +1,60 @@
+package testUtils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorderMeasuredPhases(t *testing.T) {
+	r := NewRecorder()
+	start := time.Now()
+	included := func(at time.Duration) TxIncluded {
+		when := start.Add(at)
+		return TxIncluded{Success: true, SubmitTime: when, AckTime: when, IncludeTime: when, ObserveTime: when}
+	}
+	r.Handle(PhaseStarted{Phase: "warmup", Time: start})
+	r.Handle(TxSubmitted{Time: start})
+	r.Handle(included(0))
+	r.Handle(PhaseStarted{Phase: "steady", Measured: true, Time: start.Add(time.Second)})
+	for i := 0; i < 4; i++ {
+		r.Handle(TxSubmitted{Time: start.Add(time.Second)})
+		r.Handle(included(time.Second))
+	}
+	r.Handle(PhaseStarted{Phase: "cooldown", Time: start.Add(time.Second * 3)})
+	r.Handle(TxSubmitted{Time: start.Add(time.Second * 3)})
+	r.Handle(included(time.Second * 3))
+
+	if r.total.submitted != 4 || r.total.goodTx != 4 {
+		t.Errorf("total %d submitted, %d succeeded, want 4 and 4", r.total.submitted, r.total.goodTx)
+	}
+	if r.total.latency.Count() != 4 {
+		t.Errorf("total latency of %d txns, want 4", r.total.latency.Count())
+	}
+	if d := r.duration(); d != time.Second*2 {
+		t.Errorf("total duration %s, want the 2s of the measured phase", d)
+	}
+	r.endPhase(start.Add(time.Second * 4))
+	r.Close()
+
+	want := []phaseRecord{
+		{name: "warmup", duration: time.Second, data: recordData{submitted: 1, goodTx: 1}},
+		{name: "steady", measured: true, duration: time.Second * 2, data: recordData{submitted: 4, goodTx: 4}},
+		{name: "cooldown", duration: time.Second, data: recordData{submitted: 1, goodTx: 1}},
+	}
+	if len(r.phases) != len(want) {
+		t.Fatalf("%d phases recorded, want %d", len(r.phases), len(want))
+	}
+	for i, w := range want {
+		p := r.phases[i]
+		if p.name != w.name || p.measured != w.measured || p.duration != w.duration ||
+			p.data.submitted != w.data.submitted || p.data.goodTx != w.data.goodTx {
+			t.Errorf("phase %d: %s measured %t, %s, %d submitted, %d succeeded, want %s measured %t, %s, %d, %d",
+				i, p.name, p.measured, p.duration, p.data.submitted, p.data.goodTx,
+				w.name, w.measured, w.duration, w.data.submitted, w.data.goodTx)
+		}
+	}
+	// the phases are done, the total still covers the measured one only
+	if d := r.duration(); d != time.Second*2 {
+		t.Errorf("total duration %s after the phases, want 2s", d)
+	}
+}
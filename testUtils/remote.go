@@ -0,0 +1,119 @@
+package testUtils
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/KSlashh/test-eth/units"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Shard is the funded accounts of the instances first to first+count-1, the
+// part of a distributed test run by one worker.
+type Shard struct {
+	first int
+	pairs []*pair
+}
+
+// FundShard funds the accounts of the instances first to first+count-1, it
+// returns the funding error, or ctx.Err() when interrupted.
+func FundShard(ctx context.Context, pool *api.ClientPool, privateKeyHex string, initEther *units.Amount, first int, count int) (*Shard, error) {
+	log.Infof("Fund the accounts of instances %d to %d", first, first+count-1)
+	pairs, err := fundPairs(ctx, pool, privateKeyHex, initEther, first, count)
+	if err != nil {
+		return nil, err
+	}
+	return &Shard{first: first, pairs: pairs}, nil
+}
+
+// RunShard runs transferInstance for the instances of shard until ctrl stops,
+// the events going to the Recorder and to sinks.
+func RunShard(ctrl *RunController, pool *api.ClientPool, shard *Shard, sinks ...Sink) {
+	count := len(shard.pairs)
+	events := NewEventStream(10000*count, append(runSinks(ctrl, pool, nil, nil, true), sinks...)...)
+	log.Infof("Start shard of instances %d to %d", shard.first, shard.first+count-1)
+	ctrl.Run(count, transferInstance(pool, shard.pairs, shard.first, events))
+	events.Close()
+	log.Infof("Done shard (%s). Sent-Txns: %d, Failed-Txns: %d", ctrl.StopReason(), ctrl.SentTxns(), ctrl.FailedTxns())
+}
+
+// RemoteRun is a test run whose events are emitted by other processes, it
+// aggregates them into the data, report and SLOs of a single run.
+type RemoteRun struct {
+	ctrl        *RunController
+	events      *EventStream
+	run         *report.Run
+	slo         *SLOSink
+	pool        *api.ClientPool
+	client      *ethclient.Client
+	startHeight *big.Int
+}
+
+func NewRemoteRun(ctx context.Context, pool *api.ClientPool, title string, cond StopConditions) (*RemoteRun, error) {
+	client := pool.Client(0)
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	r := &RemoteRun{
+		ctrl:        NewRunController(ctx, cond),
+		run:         newRun(title),
+		pool:        pool,
+		client:      client,
+		startHeight: header.Number,
+	}
+	r.slo = newSLOSink(r.ctrl, r.run, client)
+	r.events = NewEventStream(100000, runSinks(r.ctrl, pool, r.run, r.slo, true)...)
+	log.Infof("Start test with %s. Start at block %s.", cond, r.startHeight.String())
+	return r, nil
+}
+
+// Controller stops the run on its duration, its error budget or an interrupt,
+// the workers are expected to follow.
+func (r *RemoteRun) Controller() *RunController {
+	return r.ctrl
+}
+
+// AddSummary adds a line to the summary of the report, if one is written.
+func (r *RemoteRun) AddSummary(name string, value interface{}) {
+	if r.run != nil {
+		r.run.AddSummary(name, value)
+	}
+}
+
+// Emit passes an event of a worker to the sinks, and counts its failures
+// against the error budget. It must not be called after Finish.
+func (r *RemoteRun) Emit(e Event) {
+	switch e := e.(type) {
+	case TxIncluded:
+		r.ctrl.TxDone(e.Success)
+	case TxFailed:
+		r.ctrl.TxDone(false)
+	case RPCError:
+		if e.Method == transferMethod {
+			r.ctrl.TxDone(false)
+		}
+	}
+	r.events.Emit(e)
+}
+
+// Finish ends the run once every worker is done, writes its report and
+// returns the error of the SLOs that failed.
+func (r *RemoteRun) Finish() error {
+	r.ctrl.Stop("all workers done")
+	r.events.Close()
+	header, err := r.client.HeaderByNumber(context.Background(), nil)
+	if err == nil {
+		log.Infof("Done test (%s). Started at block %s, end at block %s.", r.ctrl.StopReason(), r.startHeight.String(), header.Number.String())
+	}
+	if r.run != nil {
+		finishRun(r.client, r.run, r.ctrl, r.startHeight, header)
+	}
+	if r.slo != nil {
+		return r.slo.Err()
+	}
+	return nil
+}
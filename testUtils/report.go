@@ -0,0 +1,252 @@
+package testUtils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var reportFile string
+var resultFile string
+var reportSettings []report.Field
+var reportSampleInterval = time.Second * 5
+var maxReportBlocks uint64 = 10000
+var reportBlocksTimeout = time.Minute * 2
+
+// EnableReport makes the next test run or recording write an html report to
+// htmlPath and its data as a result file to resultPath when it ends, either
+// may be empty. settings are the configuration table of the report.
+func EnableReport(htmlPath string, resultPath string, settings []report.Field) {
+	reportFile = htmlPath
+	resultFile = resultPath
+	reportSettings = settings
+}
+
+// newRun returns the report of a run, nil when reports are disabled.
+func newRun(title string) *report.Run {
+	if reportFile == "" && resultFile == "" {
+		return nil
+	}
+	return report.New(title, append([]report.Field(nil), reportSettings...))
+}
+
+func (b BlockInfo) reportBlock() report.Block {
+	return report.Block{
+		Number:   b.Number,
+		Time:     b.Time,
+		Interval: b.Interval,
+		Txns:     b.Txns,
+		Fill:     b.Fill(),
+	}
+}
+
+// metrics are the final numbers of d, over duration.
+func (d *recordData) metrics(duration time.Duration) report.Metrics {
+	m := report.Metrics{
+		Submitted: d.submitted,
+		Succeeded: d.goodTx,
+		Failed:    d.badTx,
+		RPCErrors: d.rpcErrors,
+	}
+	if duration > 0 {
+		m.Tps = float64(d.goodTx) / duration.Seconds()
+	}
+	if d.latency.Count() > 0 {
+		q := d.latency.Quantiles(TotalStage, 0.5, 0.9, 0.99, 1)
+		m.LatencyP50, m.LatencyP90, m.LatencyP99, m.LatencyMax = q[0], q[1], q[2], q[3]
+	}
+	return m
+}
+
+// ReportSink samples the event stream into the time series of a run report
+// every reportSampleInterval, and adds the final data to its summary. In a
+// campaign the samples cover every phase, the summary only the measured ones.
+type ReportSink struct {
+	run         *report.Run
+	total       recordData
+	window      recordData
+	windowStart time.Time
+
+	phase     *report.Phase // nil outside of campaigns
+	phaseData recordData
+	measured  time.Duration // of the phases done
+}
+
+func NewReportSink(run *report.Run) *ReportSink {
+	return &ReportSink{run: run, windowStart: time.Now()}
+}
+
+func (s *ReportSink) Handle(e Event) {
+	if time.Since(s.windowStart) >= reportSampleInterval {
+		s.sample()
+	}
+	if p, ok := e.(PhaseStarted); ok {
+		s.endPhase(p.Time)
+		s.phase = &report.Phase{
+			Name:      p.Phase,
+			Workload:  p.Workload,
+			Instances: p.Instances,
+			Measured:  p.Measured,
+			Start:     p.Time,
+		}
+		return
+	}
+	s.window.add(e)
+	if s.phase == nil || s.phase.Measured {
+		s.total.add(e)
+	}
+	if s.phase != nil {
+		s.phaseData.add(e)
+	}
+}
+
+// endPhase adds the data of the current phase to the run.
+func (s *ReportSink) endPhase(end time.Time) {
+	if s.phase == nil {
+		return
+	}
+	s.phase.End = end
+	s.phase.Metrics = s.phaseData.metrics(s.phase.Duration())
+	if s.phase.Measured {
+		s.measured += s.phase.Duration()
+	}
+	s.run.Phases = append(s.run.Phases, *s.phase)
+	s.phase = nil
+	s.phaseData = recordData{}
+}
+
+func (s *ReportSink) sample() {
+	now := time.Now()
+	q := s.window.latency.Quantiles(TotalStage, 0.5, 0.9, 0.99)
+	s.run.Samples = append(s.run.Samples, report.Sample{
+		Time:      now,
+		Tps:       float64(s.window.goodTx) / now.Sub(s.windowStart).Seconds(),
+		P50:       q[0],
+		P90:       q[1],
+		P99:       q[2],
+		Failed:    s.window.badTx,
+		RPCErrors: s.window.rpcErrors,
+	})
+	s.window = recordData{}
+	s.windowStart = now
+}
+
+func (s *ReportSink) Close() {
+	if s.window.submitted > 0 || s.window.goodTx > 0 || s.window.badTx > 0 {
+		s.sample()
+	}
+	run := s.run
+	duration := time.Since(run.Start)
+	if s.phase != nil || len(run.Phases) > 0 {
+		s.endPhase(time.Now())
+		duration = s.measured
+		run.AddSummary("Measured phases", strings.Join(measuredPhases(run.Phases), ", "))
+	}
+	run.Metrics = s.total.metrics(duration)
+	run.AddSummary("Duration", duration.Round(time.Second))
+	run.AddSummary("Submitted txns", s.total.submitted)
+	run.AddSummary("Succeed txns", s.total.goodTx)
+	run.AddSummary("Failed txns", s.total.badTx)
+	run.AddSummary("Rpc errors", s.total.rpcErrors)
+	run.AddSummary("Tps", fmt.Sprintf("%.2f", run.Metrics.Tps))
+	if s.total.latency.Count() == 0 {
+		return
+	}
+	for stage, name := range stageNames {
+		q := s.total.latency.Quantiles(stage, 0.5, 0.9, 0.99, 1)
+		run.AddSummary(name+" latency", fmt.Sprintf("average %d ms, p50 %d ms, p90 %d ms, p99 %d ms, max %d ms",
+			s.total.latency.Average(stage), q[0], q[1], q[2], q[3]))
+	}
+}
+
+func measuredPhases(phases []report.Phase) []string {
+	var names []string
+	for _, p := range phases {
+		if p.Measured {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// addBlocks adds the blocks in (start, end] to run, at most the last
+// maxReportBlocks of them.
+func addBlocks(ctx context.Context, client *ethclient.Client, run *report.Run, start, end *big.Int) error {
+	from, to := start.Uint64(), end.Uint64()
+	if to-from > maxReportBlocks {
+		from = to - maxReportBlocks
+	}
+	parent, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(from))
+	if err != nil {
+		return err
+	}
+	parentTime := parent.Time
+	for n := from + 1; n <= to; n++ {
+		block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return err
+		}
+		info := NewBlockInfo(block, parentTime)
+		parentTime = info.Time
+		run.Blocks = append(run.Blocks, info.reportBlock())
+	}
+	return nil
+}
+
+// finishRun adds the blocks of the run and its stop reason to run and writes
+// it, end is nil when the last block could not be fetched.
+func finishRun(client *ethclient.Client, run *report.Run, ctrl *RunController, start *big.Int, end *types.Header) {
+	run.AddSummary("Stop reason", ctrl.StopReason())
+	if end != nil {
+		run.AddSummary("Blocks", fmt.Sprintf("%s to %s", start, end.Number))
+		ctx, cancel := context.WithTimeout(context.Background(), reportBlocksTimeout)
+		defer cancel()
+		if err := addBlocks(ctx, client, run, start, end.Number); err != nil {
+			log.Warnf("get blocks of the report fail: %v", err)
+		}
+	}
+	writeReport(run)
+}
+
+// addBlockSummary adds the data of a recording to the summary of run.
+func addBlockSummary(run *report.Run, stats *BlockStats, start, end uint64) {
+	run.AddSummary("Blocks", fmt.Sprintf("%d to %d", start, end))
+	run.AddSummary("Duration", fmt.Sprintf("%d s", stats.Duration))
+	run.AddSummary("Recorded blocks", stats.Blocks)
+	run.AddSummary("Empty block ratio", fmt.Sprintf("%.2f%%", stats.EmptyRatio()*100))
+	run.AddSummary("Total txns", stats.Txns)
+	run.AddSummary("Tps", fmt.Sprintf("%.2f", stats.Tps()))
+	run.Metrics.Tps = stats.Tps()
+	run.Metrics.Succeeded = int64(stats.Txns)
+	run.AddSummary("Gas/s", fmt.Sprintf("%.0f", stats.GasPerSecond()))
+	run.AddSummary("Block fill", fmt.Sprintf("%.2f%%", stats.Fill()*100))
+	run.AddSummary("Average block size", fmt.Sprintf("%d bytes", stats.AverageSize()))
+	run.AddSummary("Block interval p50/p99/max", fmt.Sprintf("%d/%d/%d s",
+		stats.IntervalQuantile(0.5), stats.IntervalQuantile(0.99), stats.IntervalQuantile(1)))
+}
+
+// writeReport writes run to reportFile and resultFile.
+func writeReport(run *report.Run) {
+	run.End = time.Now()
+	if reportFile != "" {
+		if err := report.WriteHTMLFile(reportFile, run); err != nil {
+			log.Errorf("write report fail: %v", err)
+		} else {
+			log.Infof("Report written to %s", reportFile)
+		}
+	}
+	if resultFile != "" {
+		if err := report.WriteJSONFile(resultFile, run); err != nil {
+			log.Errorf("write result fail: %v", err)
+		} else {
+			log.Infof("Result written to %s", resultFile)
+		}
+	}
+}
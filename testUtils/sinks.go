@@ -0,0 +1,108 @@
+package testUtils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/metrics"
+)
+
+func eventName(e Event) string {
+	switch e.(type) {
+	case InstanceStarted:
+		return "InstanceStarted"
+	case InstanceStopped:
+		return "InstanceStopped"
+	case TxSubmitted:
+		return "TxSubmitted"
+	case TxIncluded:
+		return "TxIncluded"
+	case TxFailed:
+		return "TxFailed"
+	case RPCError:
+		return "RPCError"
+	case PhaseStarted:
+		return "PhaseStarted"
+	default:
+		return fmt.Sprintf("%T", e)
+	}
+}
+
+// FileSink writes every event as one json line {"Type": ..., "Event": ...}.
+type FileSink struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	return &FileSink{file: file, w: w}, nil
+}
+
+func (s *FileSink) Handle(e Event) {
+	data, err := MarshalEvent(e)
+	if err == nil {
+		data = append(data, '\n')
+		_, err = s.w.Write(data)
+	}
+	if err != nil {
+		log.Errorf("write event fail: %v", err)
+	}
+}
+
+func (s *FileSink) Close() {
+	if err := s.w.Flush(); err != nil {
+		log.Errorf("flush event file fail: %v", err)
+	}
+	s.file.Close()
+}
+
+// MetricsSink counts events by type and exposes them on the metrics endpoint.
+type MetricsSink struct {
+	mu           sync.Mutex
+	counts       map[string]uint64
+	confirmSum   float64 // second
+	confirmCount uint64
+	gasUsed      uint64
+}
+
+func NewMetricsSink() *MetricsSink {
+	s := &MetricsSink{counts: map[string]uint64{}}
+	metrics.Register("events", s.WriteMetrics)
+	return s
+}
+
+func (s *MetricsSink) Handle(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[eventName(e)]++
+	if inc, ok := e.(TxIncluded); ok {
+		s.confirmSum += inc.ConfirmTime().Seconds()
+		s.confirmCount++
+		s.gasUsed += inc.GasUsed
+	}
+}
+
+func (s *MetricsSink) Close() {}
+
+func (s *MetricsSink) WriteMetrics(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(w, "# TYPE loadtest_events_total counter")
+	for _, name := range []string{"InstanceStarted", "InstanceStopped", "TxSubmitted", "TxIncluded", "TxFailed", "RPCError", "PhaseStarted"} {
+		fmt.Fprintf(w, "loadtest_events_total{type=%q} %d\n", name, s.counts[name])
+	}
+	fmt.Fprintln(w, "# TYPE loadtest_confirm_seconds summary")
+	fmt.Fprintf(w, "loadtest_confirm_seconds_sum %g\n", s.confirmSum)
+	fmt.Fprintf(w, "loadtest_confirm_seconds_count %d\n", s.confirmCount)
+	fmt.Fprintln(w, "# TYPE loadtest_gas_used_total counter")
+	fmt.Fprintf(w, "loadtest_gas_used_total %d\n", s.gasUsed)
+}
@@ -0,0 +1,437 @@
+package testUtils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KSlashh/test-eth/config"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// When an SLO metric can be checked during a run: metrics which only grow
+// always, statistics once sloMinTxns txns are finished, tps only at the end.
+const (
+	sloAlways = iota
+	sloEnoughTxns
+	sloFinal
+)
+
+var sloMinTxns int64 = 100
+var sloCheckInterval = time.Second * 1
+
+type sloMetric struct {
+	unit  string // "ms", "s", "%" or "" for plain numbers
+	when  int
+	value func(d *sloData) (float64, bool) // false when there is no data
+}
+
+func latencyQuantile(q float64) func(d *sloData) (float64, bool) {
+	return func(d *sloData) (float64, bool) {
+		if d.total.latency.Count() == 0 {
+			return 0, false
+		}
+		return float64(d.total.latency.Quantiles(TotalStage, q)[0]), true
+	}
+}
+
+var sloMetrics = map[string]sloMetric{
+	"latency_p50": {"ms", sloEnoughTxns, latencyQuantile(0.5)},
+	"latency_p90": {"ms", sloEnoughTxns, latencyQuantile(0.9)},
+	"latency_p99": {"ms", sloEnoughTxns, latencyQuantile(0.99)},
+	"latency_max": {"ms", sloAlways, latencyQuantile(1)},
+	"failure_rate": {"%", sloEnoughTxns, func(d *sloData) (float64, bool) {
+		finished := d.total.goodTx + d.total.badTx
+		if finished == 0 {
+			return 0, false
+		}
+		return float64(d.total.badTx) * 100 / float64(finished), true
+	}},
+	"failed_txns": {"", sloAlways, func(d *sloData) (float64, bool) {
+		return float64(d.total.badTx), true
+	}},
+	"rpc_errors": {"", sloAlways, func(d *sloData) (float64, bool) {
+		return float64(d.total.rpcErrors), true
+	}},
+	"block_interval_max": {"s", sloAlways, func(d *sloData) (float64, bool) {
+		max, ok := d.blockIntervalMax()
+		return max.Seconds(), ok
+	}},
+	"tps": {"", sloFinal, func(d *sloData) (float64, bool) {
+		duration := d.duration()
+		if duration <= 0 {
+			return 0, false
+		}
+		return float64(d.total.goodTx) / duration.Seconds(), true
+	}},
+}
+
+func sloMetricNames() string {
+	var names []string
+	for name := range sloMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// SLO is one assertion on a load test, like "latency_p99 < 3s",
+// "failure_rate < 0.1%", "block_interval_max <= 10s" or "tps >= 95% target".
+type SLO struct {
+	Check  string
+	Hard   bool
+	metric string
+	op     string
+	limit  float64 // in the unit of the metric
+}
+
+// ParseSLO reads "<metric> <op> <value>". Latency values are durations,
+// block_interval_max too, failure_rate is a percentage and a tps may be a
+// percentage of targetTps like "95% target".
+func ParseSLO(check string, hard bool, targetTps float64) (*SLO, error) {
+	fields := strings.Fields(check)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("SLO %q must be \"<metric> <op> <value>\"", check)
+	}
+	s := &SLO{Check: check, Hard: hard, metric: fields[0], op: fields[1]}
+	m, ok := sloMetrics[s.metric]
+	if !ok {
+		return nil, fmt.Errorf("SLO %q: unknown metric %q, must be one of %s", check, s.metric, sloMetricNames())
+	}
+	switch s.op {
+	case "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("SLO %q: unknown operator %q, must be <, <=, > or >=", check, s.op)
+	}
+	value := strings.Join(fields[2:], " ")
+	var err error
+	switch m.unit {
+	case "ms", "s":
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		s.limit = d.Seconds()
+		if m.unit == "ms" {
+			s.limit = float64(d.Milliseconds())
+		}
+	case "%":
+		if !strings.HasSuffix(value, "%") {
+			return nil, fmt.Errorf("SLO %q: %s must be a percentage", check, s.metric)
+		}
+		s.limit, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	default:
+		if strings.HasSuffix(value, "% target") && s.metric == "tps" {
+			if targetTps <= 0 {
+				return nil, fmt.Errorf("SLO %q: TargetTps is not set", check)
+			}
+			var percent float64
+			percent, err = strconv.ParseFloat(strings.TrimSuffix(value, "% target"), 64)
+			s.limit = percent / 100 * targetTps
+		} else {
+			s.limit, err = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SLO %q: bad value %q: %v", check, value, err)
+	}
+	return s, nil
+}
+
+func (s *SLO) holds(v float64) bool {
+	switch s.op {
+	case "<":
+		return v < s.limit
+	case "<=":
+		return v <= s.limit
+	case ">":
+		return v > s.limit
+	default:
+		return v >= s.limit
+	}
+}
+
+func (s *SLO) format(v float64) string {
+	switch unit := sloMetrics[s.metric].unit; unit {
+	case "ms":
+		return (time.Duration(v) * time.Millisecond).String()
+	case "s":
+		return time.Duration(v * float64(time.Second)).String()
+	case "%":
+		return fmt.Sprintf("%.3f%%", v)
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+var slos []*SLO
+var sloFailFast bool
+
+// EnableSLOs parses the SLOs checked by the next load tests, failFast stops a
+// test as soon as one of the hard ones is violated.
+func EnableSLOs(list []config.SLO, targetTps float64, failFast bool) error {
+	slos = nil
+	for _, c := range list {
+		s, err := ParseSLO(c.Check, c.Hard, targetTps)
+		if err != nil {
+			return err
+		}
+		slos = append(slos, s)
+	}
+	sloFailFast = failFast
+	return nil
+}
+
+// sloData is what the SLOs are checked against, the events of the measured
+// phases of a campaign. Block intervals are taken between consecutive chain
+// headers only, counting the blocks whose timestamp falls in measured time.
+type sloData struct {
+	total     recordData
+	start     time.Time // of the current measured phase
+	measuring bool
+	measured  time.Duration // of the measured phases done
+	windows   []timeWindow  // of the measured phases done
+	lastBlock *types.Header
+	blocks    []uint64 // timestamps of the consecutive blocks seen
+}
+
+type timeWindow struct {
+	start, end time.Time
+}
+
+func (d *sloData) startPhase(p PhaseStarted) {
+	if d.measuring {
+		d.measured += p.Time.Sub(d.start)
+		d.windows = append(d.windows, timeWindow{d.start, p.Time})
+	}
+	d.measuring = p.Measured
+	d.start = p.Time
+}
+
+func (d *sloData) duration() time.Duration {
+	if d.measuring {
+		return d.measured + time.Since(d.start)
+	}
+	return d.measured
+}
+
+// measuredAt tells whether a block with timestamp t was sealed in measured
+// time, to the second of the header timestamps.
+func (d *sloData) measuredAt(t time.Time) bool {
+	if d.measuring && !t.Before(d.start.Truncate(time.Second)) {
+		return true
+	}
+	for _, w := range d.windows {
+		if !t.Before(w.start.Truncate(time.Second)) && t.Before(w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// addBlock adds the header of the block following the last one added.
+func (d *sloData) addBlock(header *types.Header) {
+	d.lastBlock = header
+	d.blocks = append(d.blocks, header.Time)
+}
+
+// blockIntervalMax is the longest interval between consecutive blocks seen,
+// of the blocks sealed in measured time.
+func (d *sloData) blockIntervalMax() (time.Duration, bool) {
+	var max time.Duration
+	found := false
+	for i := 1; i < len(d.blocks); i++ {
+		if !d.measuredAt(time.Unix(int64(d.blocks[i]), 0)) {
+			continue
+		}
+		interval := time.Duration(d.blocks[i]-d.blocks[i-1]) * time.Second
+		if !found || interval > max {
+			max = interval
+			found = true
+		}
+	}
+	return max, found
+}
+
+// SLOResult is the outcome of one SLO at the end of a run. An SLO without
+// data, like a latency SLO of a run which never waits for receipts, neither
+// passes nor fails.
+type SLOResult struct {
+	Check  string
+	Hard   bool
+	Passed bool
+	NoData bool
+	Actual string
+}
+
+// SLOSink checks the SLOs every sloCheckInterval during a run, following the
+// chain headers for the block intervals, and once more when the stream is
+// closed, with every header sealed until then.
+type SLOSink struct {
+	ctrl   *RunController
+	run    *report.Run
+	client *ethclient.Client
+
+	mu       sync.Mutex
+	data     sloData
+	violated map[*SLO]bool
+
+	results []SLOResult
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newSLOSink returns nil when no SLO is enabled, run may be nil.
+func newSLOSink(ctrl *RunController, run *report.Run, client *ethclient.Client) *SLOSink {
+	if len(slos) == 0 {
+		return nil
+	}
+	s := &SLOSink{
+		ctrl:     ctrl,
+		run:      run,
+		client:   client,
+		data:     sloData{start: time.Now(), measuring: true},
+		violated: map[*SLO]bool{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *SLOSink) Handle(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := e.(PhaseStarted); ok {
+		s.data.startPhase(p)
+		return
+	}
+	if s.data.measuring {
+		s.data.total.add(e)
+	}
+}
+
+func (s *SLOSink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(sloCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.pollBlocks()
+			s.check()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// pollBlocks adds the headers of the blocks sealed since the last poll.
+func (s *SLOSink) pollBlocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), sloCheckInterval)
+	defer cancel()
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		recorderLog.Debug("poll head for SLOs fail", "err", err)
+		return
+	}
+	s.mu.Lock()
+	last := s.data.lastBlock
+	s.mu.Unlock()
+	if last == nil {
+		s.mu.Lock()
+		s.data.addBlock(head)
+		s.mu.Unlock()
+		return
+	}
+	for n := last.Number.Uint64() + 1; n <= head.Number.Uint64(); n++ {
+		header := head
+		if n < head.Number.Uint64() {
+			if header, err = s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(n)); err != nil {
+				return
+			}
+		}
+		s.mu.Lock()
+		s.data.addBlock(header)
+		s.mu.Unlock()
+	}
+}
+
+func (s *SLOSink) check() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.data.measuring {
+		return
+	}
+	enough := s.data.total.goodTx+s.data.total.badTx >= sloMinTxns
+	for _, slo := range slos {
+		m := sloMetrics[slo.metric]
+		if m.when == sloFinal || (m.when == sloEnoughTxns && !enough) {
+			continue
+		}
+		v, ok := m.value(&s.data)
+		if !ok || slo.holds(v) {
+			s.violated[slo] = false
+			continue
+		}
+		if !s.violated[slo] {
+			recorderLog.Warnf("SLO violated: %s, actual %s", slo.Check, slo.format(v))
+		}
+		s.violated[slo] = true
+		if slo.Hard && sloFailFast {
+			s.ctrl.Stop("SLO violated: " + slo.Check)
+		}
+	}
+}
+
+func (s *SLOSink) Close() {
+	close(s.stop)
+	<-s.done
+	s.pollBlocks()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, slo := range slos {
+		res := SLOResult{Check: slo.Check, Hard: slo.Hard, NoData: true, Actual: "no data"}
+		if v, ok := sloMetrics[slo.metric].value(&s.data); ok {
+			res.NoData = false
+			res.Passed = slo.holds(v)
+			res.Actual = slo.format(v)
+		}
+		var summary string
+		switch {
+		case res.NoData:
+			summary = "NO DATA"
+			recorderLog.Warnf("SLO %s: %s", slo.Check, summary)
+		case res.Passed:
+			summary = "PASS, actual " + res.Actual
+			recorderLog.Infof("SLO %s: %s", slo.Check, summary)
+		default:
+			summary = "FAIL, actual " + res.Actual
+			recorderLog.Errorf("SLO %s: %s", slo.Check, summary)
+		}
+		if s.run != nil {
+			s.run.AddSummary("SLO "+slo.Check, summary)
+		}
+		s.results = append(s.results, res)
+	}
+}
+
+// Err is the error of the SLOs that failed, nil when all passed or had no
+// data.
+func (s *SLOSink) Err() error {
+	var failed []string
+	for _, r := range s.results {
+		if !r.Passed && !r.NoData {
+			failed = append(failed, r.Check)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d SLO(s) failed: %s", len(failed), strings.Join(failed, "; "))
+}
@@ -0,0 +1,95 @@
+package testUtils
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KSlashh/test-eth/config"
+	"github.com/KSlashh/test-eth/units"
+)
+
+func enableTestSLOs(t *testing.T, failFast bool, checks ...string) {
+	var list []config.SLO
+	for _, c := range checks {
+		list = append(list, config.SLO{Check: c, Hard: true})
+	}
+	if err := EnableSLOs(list, 0, failFast); err != nil {
+		t.Fatal(err)
+	}
+	interval := sloCheckInterval
+	sloCheckInterval = time.Millisecond * 100
+	t.Cleanup(func() {
+		EnableSLOs(nil, 0, false)
+		sloCheckInterval = interval
+	})
+}
+
+func TestSLOFailFastOnStalledChain(t *testing.T) {
+	// the test chain seals only when txns are pending, without any it stalls
+	enableTestSLOs(t, true, "block_interval_max <= 1s")
+	pool := testPool(t)
+	ctrl := NewRunController(context.Background(), StopConditions{Duration: time.Second * 30})
+	slo := newSLOSink(ctrl, nil, pool.Client(0))
+	// the interval shows with the next block, whenever it is polled
+	time.Sleep(time.Millisecond * 2500)
+	if _, err := fundPairs(context.Background(), pool, testChain.PrivateKey(), units.NewAmountOf(1, units.Ether), 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctrl.Done():
+	case <-time.After(time.Second * 10):
+		t.Fatal("the run was not stopped")
+	}
+	slo.Close()
+	if reason := ctrl.StopReason(); !strings.HasPrefix(reason, "SLO violated") {
+		t.Errorf("stop reason %q, want SLO violated", reason)
+	}
+	if slo.Err() == nil {
+		t.Error("block_interval_max passed on a stalled chain")
+	}
+}
+
+func TestSLOBlockIntervalAtClose(t *testing.T) {
+	enableTestSLOs(t, false, "block_interval_max <= 1s")
+	// no check during the run
+	sloCheckInterval = time.Hour
+	pool := testPool(t)
+	ctrl := NewRunController(context.Background(), StopConditions{})
+	defer ctrl.Stop("test done")
+	slo := newSLOSink(ctrl, nil, pool.Client(0))
+	head, err := pool.Client(0).HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slo.mu.Lock()
+	slo.data.addBlock(head)
+	slo.mu.Unlock()
+	time.Sleep(time.Millisecond * 2500)
+	if _, err := fundPairs(context.Background(), pool, testChain.PrivateKey(), units.NewAmountOf(1, units.Ether), 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	slo.Close()
+	if slo.Err() == nil {
+		t.Error("the interval of the blocks sealed before Close was not checked")
+	}
+}
+
+func TestSLONoData(t *testing.T) {
+	enableTestSLOs(t, false, "latency_p99 < 3s", "failure_rate < 1%", "rpc_errors < 1")
+	pool := testPool(t)
+	ctrl := NewRunController(context.Background(), StopConditions{})
+	slo := newSLOSink(ctrl, nil, pool.Client(0))
+	// a pipeline run only submits
+	slo.Handle(TxSubmitted{Instance: 0, Time: time.Now()})
+	slo.Close()
+	if err := slo.Err(); err != nil {
+		t.Errorf("SLOs without data failed: %v", err)
+	}
+	for _, r := range slo.results {
+		if noData := r.Check != "rpc_errors < 1"; r.NoData != noData {
+			t.Errorf("%s: no data %t, want %t", r.Check, r.NoData, noData)
+		}
+	}
+}
@@ -3,12 +3,18 @@ package testUtils
 import (
 	"context"
 	"crypto/ecdsa"
+	"fmt"
 	"math/big"
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/config"
 	"github.com/KSlashh/test-eth/log"
+	"github.com/KSlashh/test-eth/report"
+	"github.com/KSlashh/test-eth/units"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -16,217 +22,414 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-type instanceMsg struct {
-	msgType  int // 1:successTx , 2:failedTx , 3:instanceShutDown , 4:instanceStart32G
-	timeCost int // millisecond
-}
-
+// the test defaults, SetProfile replaces them with the configured profile
 var recordFrequency float64 = 5           // second
 var totalDataRecordFrequency float64 = 20 // second
 var checkTxComfirmFrequency = time.Second * 1
-var instanceTransferFrequency = time.Second * 1
-var smapleTxnAmount = big.NewInt(10000)
-var txnsPerPack = 10
-var m *sync.Mutex
+var smapleTxnAmount = units.MustParseAmount("10000wei", units.Wei)
+var shutdownGracePeriod = time.Second * 30
+var sendRetryInterval = time.Millisecond * 100
+var maxSendRetryInterval = time.Second * 5
+
+// method of the RPCError of a transfer the node refused
+const transferMethod = "TransferEth"
+
+// SetProfile applies the test defaults of a config profile.
+func SetProfile(p *config.Profile) {
+	recordFrequency = p.RecordFrequency
+	totalDataRecordFrequency = p.TotalDataRecordFrequency
+	checkTxComfirmFrequency = time.Duration(p.ConfirmPollInterval) * time.Millisecond
+	smapleTxnAmount = p.TxAmount
+	shutdownGracePeriod = time.Duration(p.ShutdownGracePeriod) * time.Millisecond
+	tpsWindowBlocks = p.TpsWindowBlocks
+	blockSummaryFrequency = p.BlockSummaryFrequency
+}
 
-func TestServer2(numOfInstance int, clientUrl string, privateKeyHex string, initEther *big.Int) {
-	client, err := ethclient.Dial(clientUrl)
-	if err != nil {
-		log.Fatal(err)
-	}
-	header, err := client.HeaderByNumber(context.Background(), nil)
+func TestServer2(ctx context.Context, numOfInstance int, pool *api.ClientPool, privateKeyHex string, initEther *units.Amount, cond StopConditions) error {
+	client := pool.Client(0)
+	header, err := client.HeaderByNumber(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	startHeight := header.Number
-	log.Infof("Start testing at height %s", startHeight.String())
-	m = new(sync.Mutex)
-	for i := 0; i < numOfInstance; i++ {
-		Instance2(clientUrl, privateKeyHex, initEther)
+	log.Infof("Fund the accounts of %d instances at block %s.", numOfInstance, startHeight.String())
+	pairs, err := fundPairs(ctx, pool, privateKeyHex, initEther, 0, numOfInstance)
+	if err != nil {
+		return err
 	}
+	ctrl := NewRunController(ctx, cond)
+	run := newRun("Pipeline load test")
+	slo := newSLOSink(ctrl, run, client)
+	// the pipeline never waits for receipts
+	events := NewEventStream(10000*numOfInstance, runSinks(ctrl, pool, run, slo, false)...)
+	log.Infof("Start test with %s.", cond)
+	ctrl.Run(numOfInstance, func(ctrl *RunController, index int) {
+		Instance2(ctrl, pool, index, pairs[index], events)
+	})
+	events.Close()
 	// Recorder2(client, startHeight)
+	header, err = client.HeaderByNumber(context.Background(), nil)
+	if err == nil {
+		log.Infof("Done test (%s). Started at block %s, end at block %s.", ctrl.StopReason(), startHeight.String(), header.Number.String())
+	}
+	log.Infof("Sent-Txns: %d, Failed-Txns: %d", ctrl.SentTxns(), ctrl.FailedTxns())
+	if run != nil {
+		finishRun(client, run, ctrl, startHeight, header)
+	}
+	pool.Report()
+	api.Stats.Report()
+	if slo != nil {
+		return slo.Err()
+	}
+	return nil
+}
+
+// runSinks returns the sinks of a test run: the Recorder, the txpool monitor
+// when enabled, the ReportSink of run and slo when not nil and the sinks
+// added with AddSink since the last run. confirmed tells whether the workload reports the outcome
+// of every tx it submitted.
+func runSinks(ctrl *RunController, pool *api.ClientPool, run *report.Run, slo *SLOSink, confirmed bool) []Sink {
+	sinks := []Sink{NewRecorder()}
+	if run != nil {
+		sinks = append(sinks, NewReportSink(run))
+	}
+	if slo != nil {
+		sinks = append(sinks, slo)
+	}
+	if txpoolMonitorInterval > 0 {
+		monitor := NewTxpoolMonitor(pool.Endpoints()[0].Rpc, confirmed)
+		monitor.Start(ctrl.Context(), txpoolMonitorInterval)
+		sinks = append(sinks, monitor)
+	}
+	return append(sinks, takeSinks()...)
+}
+
+// confirmContext returns a context for confirmation polling which outlives ctx
+// by at most shutdownGracePeriod, so that txns already sent can still be
+// confirmed after a shutdown is requested.
+func confirmContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	confirmCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stop sending, wait at most %s for pending txns", shutdownGracePeriod)
+		case <-confirmCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(shutdownGracePeriod):
+			cancel()
+		case <-confirmCtx.Done():
+		}
+	}()
+	return confirmCtx, cancel
 }
 
-func Recorder2(client *ethclient.Client, startHeight *big.Int) {
-	header, err := client.HeaderByNumber(context.Background(), startHeight)
+// Recorder2 follows the chain from startHeight and prints throughput data of
+// every block, a summary every blockSummaryFrequency blocks and a final one
+// when ctx is done. The last txpool sample of monitor is printed next to each
+// block, monitor may be nil.
+func Recorder2(ctx context.Context, client *ethclient.Client, startHeight *big.Int, monitor *TxpoolMonitor) {
+	header, err := client.HeaderByNumber(ctx, startHeight)
 	if err != nil {
-		log.Fatal(err)
+		recorderLog.Fatal(err)
 	}
 	timeStamp := header.Time
-	height := startHeight
-	log.Infof("Start recording at height %s", height.String())
-	totalTxns := big.NewInt(0)
-	totalTime := big.NewInt(0)
-	duration := big.NewInt(0)
+	height := new(big.Int).Set(startHeight)
+	recorderLog.Infof("Start recording at height %s", height.String())
+	stats := new(BlockStats)
+	validators := NewValidatorStats()
+	run := newRun("Block recording")
 	one := big.NewInt(1)
-	tmp := big.NewInt(1)
 	height.Add(height, one)
+	defer func() {
+		logBlockSummary("——————————ToTal data: ", stats, height.Uint64()-1)
+		if validators.Undecodable < validators.Blocks {
+			validators.Report()
+		}
+		if run != nil {
+			addBlockSummary(run, stats, startHeight.Uint64(), height.Uint64()-1)
+			writeReport(run)
+		}
+	}()
 	for {
-		header, err = client.HeaderByNumber(context.Background(), height)
-		if err != nil {
-			time.Sleep(time.Second * 1)
-			continue
+		select {
+		case <-ctx.Done():
+			return
+		default:
 		}
-		count, err := client.TransactionCount(context.Background(), header.Hash())
+		block, err := client.BlockByNumber(ctx, height)
 		if err != nil {
-			log.Info(err)
+			time.Sleep(time.Second * 1)
 			continue
 		}
 		height.Add(height, one)
-		time := header.Time
-		totalTxns.Add(totalTxns, tmp.SetUint64(uint64(count)))
-		duration.SetUint64(time - timeStamp)
-		totalTime.Add(totalTime, duration)
-		timeStamp = time
-		if count == 0 {
-			log.Infof("skip empty block %d", height.Int64()-1)
+		info := NewBlockInfo(block, timeStamp)
+		timeStamp = info.Time
+		stats.Add(info)
+		if run != nil {
+			run.Blocks = append(run.Blocks, info.reportBlock())
+		}
+		consensus := ""
+		if zion, err := api.DecodeZionHeader(block.Header()); err == nil {
+			round := validators.Add(zion)
+			consensus = fmt.Sprintf(", proposer: %s , round: %d ", zion.Proposer.Hex(), round)
+		} else {
+			validators.AddUndecodable()
+		}
+		if stats.Blocks%blockSummaryFrequency == 0 {
+			logBlockSummary("Block summary: ", stats, info.Number)
+		}
+		if info.Txns == 0 {
+			recorderLog.Infof("skip empty block %d", info.Number)
 			continue
 		}
-		log.Infof(""+
-			"Now height at %s : ,"+
-			"last block duration: %s s,"+
+		txpool := ""
+		if monitor != nil {
+			if sample, ok := monitor.Latest(); ok {
+				txpool = fmt.Sprintf(", txpool pending: %d , txpool queued: %d ", sample.Pending, sample.Queued)
+			}
+		}
+		recorderLog.Infof(""+
+			"Now height at %d : ,"+
+			"last block duration: %d s,"+
 			"this txns: %d ,"+
-			"total txns: %s ,"+
+			"total txns: %d ,"+
+			"gas used: %d (%.2f%% of limit) ,"+
+			"block size: %d bytes ,"+
 			"this tps: %f ,"+
-			"total tps: %s ",
-			height.String(),
-			duration.String(),
-			count,
-			totalTxns.String(),
-			float64(count)/float64(duration.Int64()),
-			tmp.Div(totalTxns, totalTime).String(),
+			"window tps: %f ,"+
+			"total tps: %f %s%s",
+			info.Number,
+			info.Interval,
+			info.Txns,
+			stats.Txns,
+			info.GasUsed,
+			info.Fill()*100,
+			info.Size,
+			perSecond(uint64(info.Txns), info.Interval),
+			stats.WindowTps(),
+			stats.Tps(),
+			consensus,
+			txpool,
 		)
 	}
 }
 
-func Instance2(clientUrl string, mainPrivateKeyHex string, initEther *big.Int) {
-	client, err := ethclient.Dial(clientUrl)
-	if err != nil {
-		log.Fatalf("Instance fail to dial client")
-	}
-    client2,_ := ethclient.Dial(clientUrl)
-	// generate 2 accounts
-	privateKeyA, err := crypto.GenerateKey()
+func logBlockSummary(title string, stats *BlockStats, height uint64) {
+	recorderLog.Infof(title+
+		"End height: %d, "+
+		"Duration: %d s, "+
+		"Blocks: %d, "+
+		"Empty-Block-Ratio: %.2f%%, "+
+		"Total txns: %d, "+
+		"Total tps: %f, "+
+		"Window tps: %f, "+
+		"Gas/s: %f, "+
+		"Block-Fill: %.2f%%, "+
+		"Average-Block-Size: %d bytes, "+
+		"Block-Interval p50/p99/max: %d/%d/%d s",
+		height,
+		stats.Duration,
+		stats.Blocks,
+		stats.EmptyRatio()*100,
+		stats.Txns,
+		stats.Tps(),
+		stats.WindowTps(),
+		stats.GasPerSecond(),
+		stats.Fill()*100,
+		stats.AverageSize(),
+		stats.IntervalQuantile(0.5),
+		stats.IntervalQuantile(0.99),
+		stats.IntervalQuantile(1),
+	)
+}
+
+// Instance2 streams signed transfers from both accounts of p as fast as the
+// node accepts them, without waiting for confirmation. One round is one tx from
+// A and one from B.
+func Instance2(ctrl *RunController, pool *api.ClientPool, index int, p *pair, events *EventStream) {
+	ctx, cancel := context.WithCancel(ctrl.Context())
+	defer cancel()
+	key := uint64(index)
+	endpoint := pool.Next(key)
+	client := endpoint.Client
+	ilog := log.Module(fmt.Sprintf("instance-%d", index))
+	privateKeyA, err := crypto.HexToECDSA(p.skA)
 	if err != nil {
-		log.Fatal(err)
+		ilog.Fatal(err)
 	}
-	privateKeyB, err := crypto.GenerateKey()
+	privateKeyB, err := crypto.HexToECDSA(p.skB)
 	if err != nil {
-		log.Fatal(err)
+		ilog.Fatal(err)
 	}
-	// skA := hexutil.Encode(crypto.FromECDSA(privateKeyA))[2:]
-	pkA := crypto.PubkeyToAddress(*privateKeyA.Public().(*ecdsa.PublicKey))
-	// skB := hexutil.Encode(crypto.FromECDSA(privateKeyB))[2:]
-	pkB := crypto.PubkeyToAddress(*privateKeyB.Public().(*ecdsa.PublicKey))
+	pkA := common.HexToAddress(p.pkA)
+	pkB := common.HexToAddress(p.pkB)
+	inflight := new(sync.WaitGroup)
 
-	// admin-->initEther-->A
-
-
-	// admin-->initEther-->B
-	pkabalance, pkbbalance := new(big.Int), new(big.Int)
-	api.TransferEth(client, mainPrivateKeyHex, pkA.Hex(), initEther)
-	for {
-		balance, _ := client.BalanceAt(context.Background(), pkA, nil)
-		time.Sleep(1 * time.Second)
-		if balance.Cmp(initEther) >= 0 {
-			pkabalance = balance
-			break
+	events.Emit(InstanceStarted{Instance: index, Time: time.Now()})
+	defer func() {
+		events.Emit(InstanceStopped{Instance: index, Time: time.Now()})
+	}()
+	send := func(tx *types.Transaction, f func(tx *types.Transaction) error) {
+		err := f(tx)
+		ctrl.TxDone(err == nil)
+		if err != nil {
+			ilog.Debug("send tx fail", "hash", tx.Hash(), "nonce", tx.Nonce(), "err", err)
+			events.Emit(RPCError{Instance: index, Method: "eth_sendRawTransaction", Err: err.Error(), Time: time.Now()})
+		} else {
+			events.Emit(TxSubmitted{Instance: index, Hash: tx.Hash(), Time: time.Now()})
 		}
+		inflight.Done()
 	}
-	api.TransferEth(client, mainPrivateKeyHex, pkB.Hex(), initEther)
-	for {
-		balance, _ := client.BalanceAt(context.Background(), pkB, nil)
-		time.Sleep(1 * time.Second)
-		if balance.Cmp(initEther) >= 0 {
-			pkbbalance = balance
-			break
-		}
+	sendPool := func(tx *types.Transaction) error {
+		return pool.SendTransaction(ctx, key, tx)
 	}
 
-	log.Infof("pka %s balance %s", pkA.Hex(), pkabalance.String())
-	log.Infof("pkb %s balance %s", pkB.Hex(), pkbbalance.String())
-
-	nonceA, err := client.NonceAt(context.Background(), pkA, nil)
-	nonceB, err := client.NonceAt(context.Background(), pkB, nil)
-	chainID := big.NewInt(102)
-	signerA := types.NewEIP155Signer(chainID)
-	signerB := types.NewEIP155Signer(chainID)
-	gasLimit := uint64(21000)
-	gasPrice := big.NewInt(1000000000)
+	nonceA, err := endpoint.NonceAt(ctx, pkA, nil)
+	if err != nil {
+		ilog.Errorf("get nonce of %s fail: %v", pkA.Hex(), err)
+		return
+	}
+	nonceB, err := endpoint.NonceAt(ctx, pkB, nil)
+	if err != nil {
+		ilog.Errorf("get nonce of %s fail: %v", pkB.Hex(), err)
+		return
+	}
+	signer, err := api.Signer(ctx, client)
+	if err != nil {
+		ilog.Errorf("get chain id fail: %v", err)
+		return
+	}
+	gasLimit := api.TransferGasLimit
+	gasPrice := api.GasPrice.Int()
 	ch1 := make(chan *types.Transaction, 1000)
 	ch2 := make(chan *types.Transaction, 1000)
+	signers := new(sync.WaitGroup)
+	signers.Add(2)
 
 	go func() {
-		for  {
-			signedTx,err := types.SignTx(
-				types.NewTransaction(nonceA, pkA, smapleTxnAmount, gasLimit, gasPrice, nil),
-				signerA,
+		defer signers.Done()
+		for round := 0; ctrl.Continue(round); round++ {
+			if !ctrl.TakeTx() {
+				break
+			}
+			signedTx, err := types.SignTx(
+				types.NewTransaction(nonceA, pkA, smapleTxnAmount.Int(), gasLimit, gasPrice, nil),
+				signer,
 				privateKeyA)
 			if err != nil {
-				nonceA,_ = client.PendingNonceAt(context.Background(), pkA)
-			} else {
-				nonceA += 1
-				if nonceA%2 == 1 {
-					ch1<-signedTx
-				} else {
-					ch2<-signedTx
+				ctrl.ReleaseTx()
+				if nonce, err := endpoint.PendingNonceAt(ctx, pkA); err == nil {
+					nonceA = nonce
 				}
+				continue
+			}
+			nonceA += 1
+			out := ch1
+			if nonceA%2 == 0 {
+				out = ch2
+			}
+			inflight.Add(1)
+			select {
+			case out <- signedTx:
+			case <-ctx.Done():
+				inflight.Done()
+				return
 			}
 		}
 	}()
 
 	go func() {
-		for  {
-			signedTx,err := types.SignTx(
-				types.NewTransaction(nonceB, pkB, smapleTxnAmount, gasLimit, gasPrice, nil),
-				signerB,
+		defer signers.Done()
+		for round := 0; ctrl.Continue(round); round++ {
+			if !ctrl.TakeTx() {
+				break
+			}
+			signedTx, err := types.SignTx(
+				types.NewTransaction(nonceB, pkB, smapleTxnAmount.Int(), gasLimit, gasPrice, nil),
+				signer,
 				privateKeyB)
 			if err != nil {
-				nonceB,_ = client.PendingNonceAt(context.Background(), pkB)
-			} else {
-				nonceB += 1
-				if nonceB%2 == 1 {
-					ch1<-signedTx
-				} else {
-					ch2<-signedTx
+				ctrl.ReleaseTx()
+				if nonce, err := endpoint.PendingNonceAt(ctx, pkB); err == nil {
+					nonceB = nonce
 				}
+				continue
+			}
+			nonceB += 1
+			out := ch1
+			if nonceB%2 == 0 {
+				out = ch2
+			}
+			inflight.Add(1)
+			select {
+			case out <- signedTx:
+			case <-ctx.Done():
+				inflight.Done()
+				return
 			}
 		}
 	}()
 
+	// stop sending once both signers are done and every queued tx is sent
 	go func() {
-		for  {
+		signers.Wait()
+		inflight.Wait()
+		cancel()
+	}()
 
+	if batchSize := pool.BatchSize(); batchSize > 0 {
+		// every sender blocks until its batch is answered, so keep enough of
+		// them running to fill a whole batch
+		senders := new(sync.WaitGroup)
+		for i := 0; i < batchSize; i++ {
+			senders.Add(1)
+			go func() {
+				defer senders.Done()
+				for {
+					select {
+					case tx := <-ch1:
+						send(tx, sendPool)
+					case tx := <-ch2:
+						send(tx, sendPool)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
 		}
-	}()
+		senders.Wait()
+		return
+	}
 
 	for {
-		select{
+		select {
 		case tx := <-ch1:
-			client.SendTransaction(context.Background(), tx)
-		case tx := <- ch2:
-			client2.SendTransaction(context.Background(), tx)
+			send(tx, sendPool)
+		case tx := <-ch2:
+			send(tx, sendPool)
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func sendETH(client *ethclient.Client, privateKey *ecdsa.PrivateKey, nonce uint64, toAddress common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int) error {
+func sendETH(ctx context.Context, client *ethclient.Client, privateKey *ecdsa.PrivateKey, nonce uint64, toAddress common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int) error {
 	var data []byte
 	tx := types.NewTransaction(nonce, toAddress, amount, gasLimit, gasPrice, data)
 
-	//chainID, err := client.ChainID(context.Background())
-	//if err != nil {
-	//	return err
-	//}
-	chainID := big.NewInt(102)
-	signer := types.NewEIP155Signer(chainID)
+	signer, err := api.Signer(ctx, client)
+	if err != nil {
+		return err
+	}
 
 	signedTx, err := types.SignTx(tx, signer, privateKey)
 	if err != nil {
 		return err
 	}
 
-	err = client.SendTransaction(context.Background(), signedTx)
+	err = client.SendTransaction(ctx, signedTx)
 	if err != nil {
 		return err
 	}
@@ -234,401 +437,359 @@ func sendETH(client *ethclient.Client, privateKey *ecdsa.PrivateKey, nonce uint6
 	return nil
 }
 
-func TestServer(numOfInstance int, clientUrl string, privateKeyhex string, initEther *big.Int, duration int, round int) {
-	msgChan := make(chan instanceMsg, 10000*numOfInstance)
-	if round > 0 {
-		for i := 0; i < numOfInstance; i++ {
-			go FixedRoundTestInstance(clientUrl, privateKeyhex, i, initEther, round, msgChan)
-		}
-	} else if duration > 0 {
-		for i := 0; i < numOfInstance; i++ {
-			go FixedTimeTestInstance(clientUrl, privateKeyhex, i, initEther, duration, msgChan)
-		}
-	} else {
-		for i := 0; i < numOfInstance; i++ {
-			go InfiniteTestInstance(clientUrl, privateKeyhex, i, initEther, msgChan)
-		}
+// TestServer funds the accounts of every instance, then runs a
+// transferInstance per instance until cond is met, and returns the error of
+// the SLOs that failed. The funding is not part of the run, its duration
+// starts once every account is funded.
+func TestServer(ctx context.Context, numOfInstance int, pool *api.ClientPool, privateKeyhex string, initEther *units.Amount, cond StopConditions) error {
+	client := pool.Client(0)
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
 	}
-	client, _ := ethclient.Dial(clientUrl)
-	header, _ := client.HeaderByNumber(context.Background(), nil)
 	startHeight := header.Number
-	log.Infof("Start test. Start at block %s.", startHeight.String())
-	Recorder(msgChan)
-	header, _ = client.HeaderByNumber(context.Background(), nil)
-	endHeight := header.Number
-	log.Infof("Done test. Started at block %s, end at block %s.", startHeight.String(), endHeight.String())
-}
-
-func Recorder(msgs chan instanceMsg) {
-	goodTxTmp := big.NewInt(0)
-	badTxTmp := big.NewInt(0)
-	totalCostTmp := big.NewInt(0)
-	var liveInstance, deadInsatance int
-	goodTx := big.NewInt(0)
-	badTx := big.NewInt(0)
-	totalCost := big.NewInt(0)
-	averageCost := big.NewInt(0)
-	one := big.NewInt(1)
-	start := time.Now()
-	timeCache := time.Now()
-	timeCache2 := time.Now()
-	for msg := range msgs {
-		switch msg.msgType {
-		case 1:
-			goodTx.Add(goodTx, one)
-			totalCost.Add(totalCost, big.NewInt(int64(msg.timeCost)))
-			goodTxTmp.Add(goodTxTmp, one)
-			totalCostTmp.Add(totalCostTmp, big.NewInt(int64(msg.timeCost)))
-		case 2:
-			badTx.Add(badTx, one)
-			badTxTmp.Add(badTxTmp, one)
-		case 3:
-			liveInstance -= 1
-			deadInsatance += 1
-			if liveInstance == 0 {
-				log.Infof("——————————ToTal data: "+
-					"Start-time: %s, "+
-					"Duration: %f s, "+
-					"Succeed-Txns: %d, "+
-					"Failed-Txns: %d, "+
-					"Running-Instance: %d, "+
-					"Dead-Instance: %d, "+
-					"Average-Comfirm-timeCost: %s ms, "+
-					"Tps: %f",
-					start.Format("2006-01-02_15:04:05"),
-					time.Since(start).Seconds(),
-					goodTx,
-					badTx,
-					liveInstance,
-					deadInsatance,
-					averageCost.Div(totalCost, goodTx),
-					float64(goodTx.Int64())/(time.Since(start).Seconds()),
-				)
-				return
-			}
-		case 4:
-			liveInstance += 1
-		default:
-		}
-		if goodTx.Int64() == 0 {
-			continue
-		}
-		if time.Since(timeCache2).Seconds() >= totalDataRecordFrequency {
-			log.Infof("——————————ToTal data: "+
-				"Start-time: %s, "+
-				"Duration: %f s, "+
-				"Succeed-Txns: %d, "+
-				"Failed-Txns: %d, "+
-				"Running-Instance: %d, "+
-				"Dead-Instance: %d, "+
-				"Average-Comfirm-timeCost: %s ms, "+
-				"Tps: %f",
-				start.Format("2006-01-02_15:04:05"),
-				time.Since(start).Seconds(),
-				goodTx,
-				badTx,
-				liveInstance,
-				deadInsatance,
-				averageCost.Div(totalCost, goodTx),
-				float64(goodTx.Int64())/(time.Since(start).Seconds()),
-			)
-			timeCache2 = time.Now()
-		}
-		if goodTxTmp.Int64() == 0 {
-			continue
-		}
-		if time.Since(timeCache).Seconds() >= recordFrequency {
-			log.Infof("Data since last record: "+
-				"Last-record-time: %s, "+
-				"Duration: %f s, "+
-				"Succeed-Txns: %d, "+
-				"Failed-Txns: %d, "+
-				"Running-Instance: %d, "+
-				"Dead-Instance: %d, "+
-				"Average-Comfirm-timeCost: %s ms, "+
-				"Tps: %f",
-				timeCache.Format("2006-01-02_15:04:05"),
-				time.Since(timeCache).Seconds(),
-				goodTxTmp,
-				badTxTmp,
-				liveInstance,
-				deadInsatance,
-				averageCost.Div(totalCostTmp, goodTxTmp),
-				float64(goodTxTmp.Int64())/(time.Since(timeCache).Seconds()),
-			)
-			goodTxTmp = big.NewInt(0)
-			badTxTmp = big.NewInt(0)
-			totalCostTmp = big.NewInt(0)
-			timeCache = time.Now()
-		}
+	log.Infof("Fund the accounts of %d instances at block %s.", numOfInstance, startHeight.String())
+	pairs, err := fundPairs(ctx, pool, privateKeyhex, initEther, 0, numOfInstance)
+	if err != nil {
+		return err
 	}
+	ctrl := NewRunController(ctx, cond)
+	run := newRun("Transfer load test")
+	slo := newSLOSink(ctrl, run, client)
+	events := NewEventStream(10000*numOfInstance, runSinks(ctrl, pool, run, slo, true)...)
+	log.Infof("Start test with %s.", cond)
+	ctrl.Run(numOfInstance, transferInstance(pool, pairs, 0, events))
+	events.Close()
+	header, err = client.HeaderByNumber(context.Background(), nil)
+	if err == nil {
+		log.Infof("Done test (%s). Started at block %s, end at block %s.", ctrl.StopReason(), startHeight.String(), header.Number.String())
+	}
+	if run != nil {
+		finishRun(client, run, ctrl, startHeight, header)
+	}
+	pool.Report()
+	api.Stats.Report()
+	if slo != nil {
+		return slo.Err()
+	}
+	return nil
 }
 
-func InfiniteTestInstance(clientUrl string, mainPrivateKeyHex string, index int, initEther *big.Int, ch chan instanceMsg) {
-	started := false
-	client, err := ethclient.Dial(clientUrl)
-	if err != nil {
-		log.Fatalf("Instance %d fail to dial client", index)
+// transferInstance transfers smapleTxnAmount back and forth between the
+// accounts of pairs[index], waiting for every tx to be confirmed. One round is
+// A-->B followed by B-->A. The instances are numbered from first on.
+func transferInstance(pool *api.ClientPool, pairs []*pair, first int, events *EventStream) Workload {
+	return func(ctrl *RunController, index int) {
+		instance := first + index
+		events.Emit(InstanceStarted{Instance: instance, Time: time.Now()})
+		defer func() {
+			events.Emit(InstanceStopped{Instance: instance, Time: time.Now()})
+		}()
+		transferRounds(ctrl, pool, instance, pairs[index], events)
 	}
+}
 
-	// generate 2 accounts
-	privateKeyA, err := crypto.GenerateKey()
-	if err != nil {
-		log.Fatal(err)
+// fundPairs funds the pairs of the instances first to first+count-1 in
+// parallel. It gives up on the first pair which could not be funded and
+// returns its error, or ctx.Err() once ctx is done.
+func fundPairs(ctx context.Context, pool *api.ClientPool, mainPrivateKeyHex string, initEther *units.Amount, first int, count int) ([]*pair, error) {
+	if _, err := crypto.HexToECDSA(mainPrivateKeyHex); err != nil {
+		return nil, fmt.Errorf("admin private key: %v", err)
+	}
+	fundCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pairs := make([]*pair, count)
+	var mu sync.Mutex
+	var firstErr error
+	wg := new(sync.WaitGroup)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := fundPair(fundCtx, pool, first+i, mainPrivateKeyHex, initEther)
+			mu.Lock()
+			defer mu.Unlock()
+			pairs[i] = p
+			if err != nil && firstErr == nil && fundCtx.Err() == nil {
+				firstErr = err
+				cancel()
+			}
+		}(i)
 	}
-	privateKeyB, err := crypto.GenerateKey()
-	if err != nil {
-		log.Fatal(err)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
 	}
-	skA := hexutil.Encode(crypto.FromECDSA(privateKeyA))[2:]
-	pkA := crypto.PubkeyToAddress(*privateKeyA.Public().(*ecdsa.PublicKey)).Hex()
-	skB := hexutil.Encode(crypto.FromECDSA(privateKeyB))[2:]
-	pkB := crypto.PubkeyToAddress(*privateKeyB.Public().(*ecdsa.PublicKey)).Hex()
-
-	// admin-->initEther-->A
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkA, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
+	return pairs, nil
+}
 
-	// admin-->initEther-->B
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkB, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
-	}
+// pair is the two accounts an instance transfers between.
+type pair struct {
+	skA, pkA string
+	skB, pkB string
+}
 
-	ch <- instanceMsg{4, 0}
-	started = true
-	defer func() {
-		if started {
-			ch <- instanceMsg{3, 0}
-		}
-	}()
-	timeCache := time.Now()
+// maxFundAttempts bounds the attempts to fund one account, fundConfirmTimeout
+// the wait for the receipt of one attempt.
+var maxFundAttempts = 30
+var fundConfirmTimeout = time.Minute
 
-	for {
-		// A-->10000wei-->B
-		hash, err := api.TransferEth(client, skA, pkB, smapleTxnAmount)
-		if err != nil {
-			continue
-		}
-		timeCache = time.Now()
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
-		}
+// fatalFundErrors are the errors of a funding tx that retrying cannot fix.
+var fatalFundErrors = []string{"insufficient funds", "invalid sender"}
 
-		// B-->10000wei-->A
-		hash, err = api.TransferEth(client, skB, pkA, smapleTxnAmount)
-		if err != nil {
-			continue
-		}
-		timeCache = time.Now()
-		isSuccess = WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
+func isFatalFundError(err error) bool {
+	for _, s := range fatalFundErrors {
+		if strings.Contains(err.Error(), s) {
+			return true
 		}
 	}
+	return false
 }
 
-func FixedTimeTestInstance(clientUrl string, mainPrivateKeyHex string, index int, initEther *big.Int, duration int, ch chan instanceMsg) {
-	started := false
-	client, err := ethclient.Dial(clientUrl)
-	if err != nil {
-		log.Fatalf("Instance %d fail to dial client", index)
-	}
+// fundPair generates the accounts of instance index and funds each of them
+// with initEther from the admin account. It gives up after maxFundAttempts
+// or on an error retrying cannot fix, and returns ctx.Err() once ctx is done.
+func fundPair(ctx context.Context, pool *api.ClientPool, index int, mainPrivateKeyHex string, initEther *units.Amount) (*pair, error) {
+	key := uint64(index)
+	endpoint := pool.Next(key)
+	ilog := log.Module(fmt.Sprintf("instance-%d", index))
 
 	// generate 2 accounts
 	privateKeyA, err := crypto.GenerateKey()
 	if err != nil {
-		log.Fatal(err)
+		ilog.Fatal(err)
 	}
 	privateKeyB, err := crypto.GenerateKey()
 	if err != nil {
-		log.Fatal(err)
+		ilog.Fatal(err)
 	}
-	skA := hexutil.Encode(crypto.FromECDSA(privateKeyA))[2:]
-	pkA := crypto.PubkeyToAddress(*privateKeyA.Public().(*ecdsa.PublicKey)).Hex()
-	skB := hexutil.Encode(crypto.FromECDSA(privateKeyB))[2:]
-	pkB := crypto.PubkeyToAddress(*privateKeyB.Public().(*ecdsa.PublicKey)).Hex()
-
-	// admin-->initEther-->A
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkA, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
+	p := &pair{
+		skA: hexutil.Encode(crypto.FromECDSA(privateKeyA))[2:],
+		pkA: crypto.PubkeyToAddress(*privateKeyA.Public().(*ecdsa.PublicKey)).Hex(),
+		skB: hexutil.Encode(crypto.FromECDSA(privateKeyB))[2:],
+		pkB: crypto.PubkeyToAddress(*privateKeyB.Public().(*ecdsa.PublicKey)).Hex(),
 	}
 
+	// admin-->initEther-->A
 	// admin-->initEther-->B
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkB, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
-	}
-
-	ch <- instanceMsg{4, 0}
-	started = true
-	defer func() {
-		if started {
-			ch <- instanceMsg{3, 0}
-		}
-	}()
-	timeCache := time.Now()
-	timeStart := time.Now()
-
-	for time.Since(timeStart).Milliseconds() >= int64(duration)*1000 {
-		// A-->10000wei-->B
-		hash, err := api.TransferEth(client, skA, pkB, smapleTxnAmount)
-		if err != nil {
-			continue
-		}
-		timeCache = time.Now()
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
-		}
-
-		// B-->10000wei-->A
-		hash, err = api.TransferEth(client, skB, pkA, smapleTxnAmount)
-		if err != nil {
-			continue
-		}
-		timeCache = time.Now()
-		isSuccess = WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
+	// every instance funds from the admin account, so retries back off to let
+	// the nonce races settle
+	for _, pk := range []string{p.pkA, p.pkB} {
+		for failures := 1; ; failures++ {
+			err := fundAccount(ctx, pool, endpoint, key, mainPrivateKeyHex, pk, initEther)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if isFatalFundError(err) || failures >= maxFundAttempts {
+				ilog.Error("fund account fail, give up", "account", pk, "attempts", failures, "err", err)
+				return nil, fmt.Errorf("fund %s of instance %d: %v", pk, index, err)
+			}
+			ilog.Warn("fund account fail, retry", "account", pk, "attempts", failures, "err", err)
+			if !sleepCtx(ctx, retryDelay(failures)) {
+				return nil, ctx.Err()
+			}
 		}
 	}
+	return p, nil
 }
 
-func FixedRoundTestInstance(clientUrl string, mainPrivateKeyHex string, index int, initEther *big.Int, round int, ch chan instanceMsg) {
-	started := false
-	client, err := ethclient.Dial(clientUrl)
+// fundAccount transfers initEther from the admin account to pk and waits for
+// the tx to succeed.
+func fundAccount(ctx context.Context, pool *api.ClientPool, endpoint *api.Endpoint, key uint64, mainPrivateKeyHex string, pk string, initEther *units.Amount) error {
+	hash, _, err := pool.TransferEth(ctx, key, mainPrivateKeyHex, pk, initEther)
 	if err != nil {
-		log.Fatalf("Instance %d fail to dial client", index)
+		return err
 	}
-
-	// generate 2 accounts
-	privateKeyA, err := crypto.GenerateKey()
+	confirmCtx, cancel := context.WithTimeout(ctx, fundConfirmTimeout)
+	defer cancel()
+	receipt, err := waitConfirm(confirmCtx, endpoint, hash[:])
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("tx %s not confirmed: %v", common.BytesToHash(hash[:]).Hex(), err)
 	}
-	privateKeyB, err := crypto.GenerateKey()
-	if err != nil {
-		log.Fatal(err)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("tx %s failed", common.BytesToHash(hash[:]).Hex())
 	}
-	skA := hexutil.Encode(crypto.FromECDSA(privateKeyA))[2:]
-	pkA := crypto.PubkeyToAddress(*privateKeyA.Public().(*ecdsa.PublicKey)).Hex()
-	skB := hexutil.Encode(crypto.FromECDSA(privateKeyB))[2:]
-	pkB := crypto.PubkeyToAddress(*privateKeyB.Public().(*ecdsa.PublicKey)).Hex()
+	return nil
+}
 
-	// admin-->initEther-->A
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkA, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
+// retryDelay is the delay before retrying a tx after failures refusals in a
+// row, it doubles from sendRetryInterval up to maxSendRetryInterval with
+// jitter so that instances refused together do not retry together.
+func retryDelay(failures int) time.Duration {
+	d := sendRetryInterval
+	for i := 1; i < failures && d < maxSendRetryInterval; i++ {
+		d *= 2
 	}
-
-	// admin-->initEther-->B
-	for {
-		hash, err := api.TransferEth(client, mainPrivateKeyHex, pkB, initEther)
-		if err != nil {
-			continue
-		}
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if isSuccess {
-			break
-		}
+	if d > maxSendRetryInterval {
+		d = maxSendRetryInterval
 	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
 
-	ch <- instanceMsg{4, 0}
-	started = true
-	defer func() {
-		if started {
-			ch <- instanceMsg{3, 0}
-		}
-	}()
-	timeCache := time.Now()
-
-	for i := 0; i < round; i++ {
-		// A-->10000wei-->B
-		hash, err := api.TransferEth(client, skA, pkB, smapleTxnAmount)
+// transferRounds runs rounds of transfers between the accounts of p until
+// ctrl stops.
+func transferRounds(ctrl *RunController, pool *api.ClientPool, index int, p *pair, events *EventStream) {
+	ctx := ctrl.Context()
+	confirmCtx, cancel := confirmContext(ctx)
+	defer cancel()
+	key := uint64(index)
+	endpoint := pool.Next(key)
+	client := endpoint.Client
+	ilog := log.Module(fmt.Sprintf("instance-%d", index))
+
+	// transfer returns false once the instance should stop
+	failures := 0
+	transfer := func(fromSk string, toPk string) bool {
+		if !ctrl.TakeTx() {
+			return false
+		}
+		hash, submitTime, err := pool.TransferEth(ctx, key, fromSk, toPk, smapleTxnAmount)
 		if err != nil {
-			continue
-		}
-		timeCache = time.Now()
-		isSuccess := WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
-		}
-
-		// B-->10000wei-->A
-		hash, err = api.TransferEth(client, skB, pkA, smapleTxnAmount)
+			ctrl.ReleaseTx()
+			if ctx.Err() != nil {
+				return false
+			}
+			// a refused tx counts against the error budget, and the next
+			// one waits so that a node refusing every tx is not hammered
+			ilog.Debug("transfer fail", "to", toPk, "err", err)
+			ctrl.TxDone(false)
+			events.Emit(RPCError{Instance: index, Method: transferMethod, Err: err.Error(), Time: time.Now()})
+			failures++
+			return sleepCtx(ctx, retryDelay(failures))
+		}
+		failures = 0
+		ackTime := time.Now()
+		events.Emit(TxSubmitted{Instance: index, Hash: hash, Time: ackTime})
+		receipt, err := waitConfirm(confirmCtx, endpoint, hash[:])
 		if err != nil {
-			continue
+			ilog.Debug("tx not confirmed", "hash", hash, "err", err)
+			ctrl.TxDone(false)
+			events.Emit(TxFailed{Instance: index, Hash: hash, Reason: "not confirmed: " + err.Error(), Time: time.Now()})
+			return false
+		}
+		observeTime := time.Now()
+		isSuccess := receipt.Status == types.ReceiptStatusSuccessful
+		ctrl.TxDone(isSuccess)
+		ilog.Debug("tx confirmed", "hash", hash, "block", receipt.BlockNumber, "success", isSuccess, "ms", observeTime.Sub(submitTime).Milliseconds())
+		includeTime, err := blockTime(confirmCtx, client, receipt.BlockNumber)
+		if err != nil {
+			events.Emit(RPCError{Instance: index, Method: "eth_getBlockByNumber", Err: err.Error(), Time: time.Now()})
+		}
+		events.Emit(TxIncluded{
+			Instance:    index,
+			Hash:        hash,
+			BlockNumber: receipt.BlockNumber.Uint64(),
+			GasUsed:     receipt.GasUsed,
+			Success:     isSuccess,
+			SubmitTime:  submitTime,
+			AckTime:     ackTime,
+			IncludeTime: includeTime,
+			ObserveTime: observeTime,
+		})
+		return true
+	}
+
+	for round := 0; ctrl.Continue(round); round++ {
+		// A-->10000wei-->B
+		if !transfer(p.skA, p.pkB) {
+			return
 		}
-		timeCache = time.Now()
-		isSuccess = WaitTransactionConfirm(client, hash[:])
-		if !isSuccess {
-			ch <- instanceMsg{2, 0}
-		} else {
-			ch <- instanceMsg{1, int(time.Since(timeCache).Milliseconds())}
+		// B-->10000wei-->A
+		if !transfer(p.skB, p.pkA) {
+			return
 		}
 	}
 }
 
-func WaitTransactionConfirm(client *ethclient.Client, hash []byte) bool {
+// WaitTransactionConfirm polls until the tx is mined and returns its receipt,
+// it gives up with ctx.Err() once ctx is done.
+func WaitTransactionConfirm(ctx context.Context, client *ethclient.Client, hash []byte) (*types.Receipt, error) {
 	for {
-		time.Sleep(checkTxComfirmFrequency)
-		_, isPending, err := client.TransactionByHash(context.Background(), common.BytesToHash(hash))
+		if !sleepCtx(ctx, checkTxComfirmFrequency) {
+			return nil, ctx.Err()
+		}
+		_, isPending, err := client.TransactionByHash(ctx, common.BytesToHash(hash))
 		if err != nil {
 			continue
 		}
 		if isPending == true {
 			continue
 		} else {
-			receipt, err := client.TransactionReceipt(context.Background(), common.BytesToHash(hash))
+			receipt, err := client.TransactionReceipt(ctx, common.BytesToHash(hash))
 			if err != nil {
 				continue
 			}
-			return receipt.Status == types.ReceiptStatusSuccessful
+			return receipt, nil
 		}
 	}
 }
+
+// waitConfirm waits for the receipt of the tx on endpoint, through its Batcher
+// when batching is enabled.
+func waitConfirm(ctx context.Context, e *api.Endpoint, hash []byte) (*types.Receipt, error) {
+	if e.Batcher != nil {
+		return waitTransactionConfirmBatch(ctx, e.Batcher, hash)
+	}
+	return WaitTransactionConfirm(ctx, e.Client, hash)
+}
+
+// waitTransactionConfirmBatch polls only the receipt, a missing receipt means
+// the tx is still pending.
+func waitTransactionConfirmBatch(ctx context.Context, batcher *api.Batcher, hash []byte) (*types.Receipt, error) {
+	for {
+		if !sleepCtx(ctx, checkTxComfirmFrequency) {
+			return nil, ctx.Err()
+		}
+		receipt, err := batcher.TransactionReceipt(ctx, common.BytesToHash(hash))
+		if err != nil {
+			continue
+		}
+		return receipt, nil
+	}
+}
+
+// sleepCtx sleeps for d and returns false if ctx is done earlier.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+var blockTimes = struct {
+	sync.Mutex
+	m map[uint64]time.Time
+}{m: map[uint64]time.Time{}}
+
+// blockTime returns the timestamp of block number, the recent ones are cached
+// since many txns share a block.
+func blockTime(ctx context.Context, client *ethclient.Client, number *big.Int) (time.Time, error) {
+	blockTimes.Lock()
+	t, ok := blockTimes.m[number.Uint64()]
+	blockTimes.Unlock()
+	if ok {
+		return t, nil
+	}
+	header, err := client.HeaderByNumber(ctx, number)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = time.Unix(int64(header.Time), 0)
+	blockTimes.Lock()
+	if len(blockTimes.m) >= 1024 {
+		blockTimes.m = map[uint64]time.Time{}
+	}
+	blockTimes.m[number.Uint64()] = t
+	blockTimes.Unlock()
+	return t, nil
+}
@@ -0,0 +1,177 @@
+package testUtils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var txpoolMonitorInterval time.Duration // disabled when 0
+
+// EnableTxpoolMonitor makes the following test and record runs poll the
+// txpool every interval.
+func EnableTxpoolMonitor(interval time.Duration) {
+	txpoolMonitorInterval = interval
+}
+
+const (
+	TxpoolStatusSource  = "txpool_status"
+	TxpoolInspectSource = "txpool_inspect"
+	InflightSource      = "in-flight"
+)
+
+type TxpoolSample struct {
+	Time    time.Time
+	Pending uint64
+	Queued  uint64
+	Source  string
+}
+
+// TxpoolMonitor polls txpool_status, or txpool_inspect when status is not
+// exposed. When the node has no txpool namespace at all it can fall back to
+// counting our own in-flight txns, which it learns about as a Sink.
+type TxpoolMonitor struct {
+	inflight int64 // accessed atomically, keep 64-bit aligned
+
+	client        *rpc.Client
+	countInflight bool
+
+	mu      sync.Mutex
+	source  string // empty once there is nothing to poll
+	samples []TxpoolSample
+}
+
+// NewTxpoolMonitor polls the txpool of client. countInflight enables the
+// in-flight fallback, which is only right when the workload emits a TxIncluded
+// or TxFailed for every TxSubmitted.
+func NewTxpoolMonitor(client *rpc.Client, countInflight bool) *TxpoolMonitor {
+	return &TxpoolMonitor{client: client, countInflight: countInflight, source: TxpoolStatusSource}
+}
+
+func (m *TxpoolMonitor) Handle(e Event) {
+	switch e.(type) {
+	case TxSubmitted:
+		atomic.AddInt64(&m.inflight, 1)
+	case TxIncluded, TxFailed:
+		atomic.AddInt64(&m.inflight, -1)
+	}
+}
+
+func (m *TxpoolMonitor) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return
+	}
+	var sum, max uint64
+	for _, s := range m.samples {
+		sum += s.Pending
+		if s.Pending > max {
+			max = s.Pending
+		}
+	}
+	recorderLog.Infof("——————————Txpool data: "+
+		"Source: %s, "+
+		"Samples: %d, "+
+		"Average-Pending: %d, "+
+		"Max-Pending: %d",
+		m.source,
+		len(m.samples),
+		sum/uint64(len(m.samples)),
+		max,
+	)
+}
+
+// Start polls every interval until ctx is done.
+func (m *TxpoolMonitor) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.poll(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (m *TxpoolMonitor) poll(ctx context.Context) {
+	m.mu.Lock()
+	source := m.source
+	m.mu.Unlock()
+	var pending, queued uint64
+	var err error
+	switch source {
+	case TxpoolStatusSource:
+		pending, queued, err = api.TxpoolStatus(ctx, m.client)
+		if err != nil && isMethodNotFound(err) {
+			log.Warnf("txpool_status not available (%v), try txpool_inspect", err)
+			m.setSource(TxpoolInspectSource)
+			m.poll(ctx)
+			return
+		}
+	case TxpoolInspectSource:
+		pending, queued, err = api.TxpoolInspect(ctx, m.client)
+		if err != nil && isMethodNotFound(err) {
+			if !m.countInflight {
+				log.Warnf("txpool namespace not available (%v), stop polling the txpool", err)
+				m.setSource("")
+				return
+			}
+			log.Warnf("txpool namespace not available (%v), count our in-flight txns instead", err)
+			m.setSource(InflightSource)
+			m.poll(ctx)
+			return
+		}
+	case InflightSource:
+		if n := atomic.LoadInt64(&m.inflight); n > 0 {
+			pending = uint64(n)
+		}
+	default:
+		return
+	}
+	if err != nil {
+		log.Warnf("poll txpool fail: %v", err)
+		return
+	}
+	sample := TxpoolSample{Time: time.Now(), Pending: pending, Queued: queued, Source: source}
+	m.mu.Lock()
+	m.samples = append(m.samples, sample)
+	m.mu.Unlock()
+	recorderLog.Infof("Txpool (%s): pending %d, queued %d", source, pending, queued)
+}
+
+func (m *TxpoolMonitor) setSource(source string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source = source
+}
+
+// Latest returns the last sample, ok is false before the first poll.
+func (m *TxpoolMonitor) Latest() (sample TxpoolSample, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return TxpoolSample{}, false
+	}
+	return m.samples[len(m.samples)-1], true
+}
+
+func (m *TxpoolMonitor) Samples() []TxpoolSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]TxpoolSample(nil), m.samples...)
+}
+
+func isMethodNotFound(err error) bool {
+	rpcErr, ok := err.(rpc.Error)
+	return ok && rpcErr.ErrorCode() == -32601
+}
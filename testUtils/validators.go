@@ -0,0 +1,191 @@
+package testUtils
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/KSlashh/test-eth/api"
+	"github.com/KSlashh/test-eth/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ValidatorStats counts proposals, missed proposals and committed seals per
+// validator over a range of Zion blocks.
+//
+// Zion picks proposers round-robin over the validator set, the proposer of
+// round r being the (r+1)th validator after the previous block's proposer.
+// So a proposer further down the list means round changes happened, and the
+// validators skipped over missed their proposal.
+type ValidatorStats struct {
+	Blocks       int
+	Undecodable  int
+	RoundChanges int // blocks not decided in round 0
+	Rounds       int // sum of the rounds of all blocks
+	Proposals    map[common.Address]int
+	Missed       map[common.Address]int
+	Signed       map[common.Address]int // committed seals
+	Absent       map[common.Address]int // blocks without the validator's committed seal
+
+	validators   []common.Address
+	lastProposer common.Address
+}
+
+func NewValidatorStats() *ValidatorStats {
+	return &ValidatorStats{
+		Proposals: map[common.Address]int{},
+		Missed:    map[common.Address]int{},
+		Signed:    map[common.Address]int{},
+		Absent:    map[common.Address]int{},
+	}
+}
+
+func indexOf(addrs []common.Address, addr common.Address) int {
+	for i, a := range addrs {
+		if a == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add records one block and returns the round it was decided in, -1 when
+// it can not be told.
+func (s *ValidatorStats) Add(h *api.ZionHeader) int {
+	s.Blocks++
+	if len(h.Validators) > 0 {
+		s.validators = h.Validators
+	}
+	s.Proposals[h.Proposer]++
+	for _, c := range h.Committers {
+		s.Signed[c]++
+	}
+	for _, v := range s.validators {
+		if indexOf(h.Committers, v) < 0 {
+			s.Absent[v]++
+		}
+	}
+
+	round := -1
+	n := len(s.validators)
+	last := indexOf(s.validators, s.lastProposer)
+	cur := indexOf(s.validators, h.Proposer)
+	if n > 0 && last >= 0 && cur >= 0 {
+		round = ((cur-last-1)%n + n) % n
+		if round > 0 {
+			s.RoundChanges++
+			s.Rounds += round
+			for k := 1; k <= round; k++ {
+				s.Missed[s.validators[(last+k)%n]]++
+			}
+		}
+	}
+	s.lastProposer = h.Proposer
+	return round
+}
+
+// AddUndecodable counts a block whose extra-data could not be decoded.
+func (s *ValidatorStats) AddUndecodable() {
+	s.Blocks++
+	s.Undecodable++
+}
+
+// ValidatorSummary is the statistics of one validator.
+type ValidatorSummary struct {
+	Address   common.Address
+	Proposals int
+	Missed    int
+	Signed    int
+	Absent    int
+}
+
+// Summaries returns the statistics of every validator seen, sorted by address.
+func (s *ValidatorStats) Summaries() []ValidatorSummary {
+	seen := map[common.Address]bool{}
+	var addrs []common.Address
+	for _, m := range []map[common.Address]int{s.Proposals, s.Missed, s.Signed} {
+		for a := range m {
+			if !seen[a] {
+				seen[a] = true
+				addrs = append(addrs, a)
+			}
+		}
+	}
+	for _, v := range s.validators {
+		if !seen[v] {
+			seen[v] = true
+			addrs = append(addrs, v)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Hex() < addrs[j].Hex() })
+	res := make([]ValidatorSummary, 0, len(addrs))
+	for _, a := range addrs {
+		res = append(res, ValidatorSummary{
+			Address:   a,
+			Proposals: s.Proposals[a],
+			Missed:    s.Missed[a],
+			Signed:    s.Signed[a],
+			Absent:    s.Absent[a],
+		})
+	}
+	return res
+}
+
+// ValidatorCount is the size of the last validator set seen.
+func (s *ValidatorStats) ValidatorCount() int {
+	return len(s.validators)
+}
+
+func (s *ValidatorStats) Report() {
+	log.Infof("——————————Validator data: "+
+		"Blocks: %d, "+
+		"Undecodable-Blocks: %d, "+
+		"Round-Changes: %d, "+
+		"Extra-Rounds: %d, "+
+		"Validators: %d",
+		s.Blocks,
+		s.Undecodable,
+		s.RoundChanges,
+		s.Rounds,
+		len(s.validators),
+	)
+	for _, v := range s.Summaries() {
+		log.Infof("Validator %s: "+
+			"Proposals: %d, "+
+			"Missed-Proposals: %d, "+
+			"Committed-Seals: %d, "+
+			"Absent-Seals: %d",
+			v.Address.Hex(),
+			v.Proposals,
+			v.Missed,
+			v.Signed,
+			v.Absent,
+		)
+	}
+}
+
+// ValidatorReport decodes the blocks in [startHeight, endHeight] and returns
+// the per-validator statistics.
+func ValidatorReport(ctx context.Context, client *ethclient.Client, startHeight uint64, endHeight uint64) (*ValidatorStats, error) {
+	stats := NewValidatorStats()
+	for height := startHeight; height <= endHeight; height++ {
+		if ctx.Err() != nil {
+			break
+		}
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+		if err != nil {
+			return nil, err
+		}
+		h, err := api.DecodeZionHeader(header)
+		if err != nil {
+			log.Warnf("block %d: %v", height, err)
+			stats.AddUndecodable()
+			continue
+		}
+		if round := stats.Add(h); round > 0 {
+			log.Infof("block %d proposed by %s in round %d", height, h.Proposer.Hex(), round)
+		}
+	}
+	return stats, nil
+}
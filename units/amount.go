@@ -0,0 +1,167 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Unit is the number of decimals of an ether denomination.
+type Unit struct {
+	Name     string
+	Decimals int
+}
+
+var (
+	Wei    = Unit{"wei", 0}
+	Kwei   = Unit{"kwei", 3}
+	Mwei   = Unit{"mwei", 6}
+	Gwei   = Unit{"gwei", 9}
+	Szabo  = Unit{"szabo", 12}
+	Finney = Unit{"finney", 15}
+	Ether  = Unit{"ether", 18}
+)
+
+var allUnits = []Unit{Wei, Kwei, Mwei, Gwei, Szabo, Finney, Ether}
+
+// displayUnits are tried from the largest when formatting, wei is the fallback.
+var displayUnits = []Unit{Ether, Gwei}
+
+func (u Unit) factor() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(u.Decimals)), nil)
+}
+
+// LookupUnit finds a unit by name, case insensitive, "eth" is an alias of ether.
+func LookupUnit(name string) (Unit, bool) {
+	name = strings.ToLower(name)
+	if name == "eth" {
+		return Ether, true
+	}
+	for _, u := range allUnits {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return Unit{}, false
+}
+
+// Amount is a non-negative quantity of wei. The zero value is 0 wei.
+type Amount big.Int
+
+func NewAmount(wei *big.Int) *Amount {
+	return (*Amount)(new(big.Int).Set(wei))
+}
+
+// NewAmountOf returns n of unit u, e.g. NewAmountOf(1, Ether).
+func NewAmountOf(n int64, u Unit) *Amount {
+	return (*Amount)(new(big.Int).Mul(big.NewInt(n), u.factor()))
+}
+
+// ParseAmount parses a decimal number followed by an optional unit, like
+// "1.5ether", "20 gwei" or "1000wei". A number without unit is read in
+// defaultUnit. More fraction digits than the unit can hold is an error
+// rather than a silent rounding.
+func ParseAmount(s string, defaultUnit Unit) (*Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty amount")
+	}
+	if s[0] == '-' {
+		return nil, fmt.Errorf("invalid amount %q: negative", s)
+	}
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == 0 {
+		return nil, fmt.Errorf("invalid amount %q: no number", s)
+	}
+	number, unit := s, defaultUnit
+	if i > 0 {
+		number = s[:i]
+		name := strings.TrimSpace(s[i:])
+		var ok bool
+		if unit, ok = LookupUnit(name); !ok {
+			return nil, fmt.Errorf("invalid amount %q: unknown unit %q", s, name)
+		}
+	}
+	intPart, fracPart := number, ""
+	if dot := strings.IndexByte(number, '.'); dot >= 0 {
+		intPart, fracPart = number[:dot], number[dot+1:]
+		if strings.IndexByte(fracPart, '.') >= 0 {
+			return nil, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("invalid amount %q: no number", s)
+	}
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > unit.Decimals {
+		return nil, fmt.Errorf("invalid amount %q: %s has at most %d decimals", s, unit.Name, unit.Decimals)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", unit.Decimals-len(fracPart))
+	wei, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return (*Amount)(wei), nil
+}
+
+// MustParseAmount is ParseAmount for constants, it panics on error.
+func MustParseAmount(s string, defaultUnit Unit) *Amount {
+	a, err := ParseAmount(s, defaultUnit)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Int returns the amount in wei, the result shares storage with a.
+func (a *Amount) Int() *big.Int {
+	return (*big.Int)(a)
+}
+
+func (a *Amount) Cmp(b *Amount) int {
+	return a.Int().Cmp(b.Int())
+}
+
+// In formats the amount as an exact decimal in unit u, without the unit name.
+func (a *Amount) In(u Unit) string {
+	q, r := new(big.Int).QuoRem(a.Int(), u.factor(), new(big.Int))
+	if r.Sign() == 0 {
+		return q.String()
+	}
+	frac := r.String()
+	frac = strings.Repeat("0", u.Decimals-len(frac)) + frac
+	return q.String() + "." + strings.TrimRight(frac, "0")
+}
+
+// String formats the amount in ether or gwei when it is at least a thousandth
+// of the unit, in wei otherwise, e.g. "1.5 ether", "0.02 ether", "20 gwei",
+// "1000 wei".
+func (a *Amount) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	for _, u := range displayUnits {
+		min := new(big.Int).Quo(u.factor(), big.NewInt(1000))
+		if a.Int().CmpAbs(min) >= 0 {
+			return a.In(u) + " " + u.Name
+		}
+	}
+	return a.In(Wei) + " wei"
+}
+
+// MarshalText keeps json output exact, amounts are written as wei strings.
+func (a *Amount) MarshalText() ([]byte, error) {
+	return []byte(a.Int().String()), nil
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := ParseAmount(string(text), Wei)
+	if err != nil {
+		return err
+	}
+	a.Int().Set(parsed.Int())
+	return nil
+}
@@ -0,0 +1,146 @@
+package units
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func wei(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("bad wei " + s)
+	}
+	return n
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in   string
+		unit Unit
+		want string // wei, empty when an error is expected
+	}{
+		{"1.5ether", Wei, "1500000000000000000"},
+		{"20 gwei", Wei, "20000000000"},
+		{"1000wei", Ether, "1000"},
+		{".5eth", Wei, "500000000000000000"},
+		{"1.", Ether, "1000000000000000000"},
+		{"2", Gwei, "2000000000"},
+		{" 3 ETHER ", Wei, "3000000000000000000"},
+		{"1.000000000000000000ether", Wei, "1000000000000000000"},
+		{"0.000000000000000001ether", Wei, "1"},
+		{"0", Ether, "0"},
+		// more decimals than the unit holds
+		{"0.0000000000000000001ether", Wei, ""},
+		{"1.5wei", Wei, ""},
+		{"1.5", Wei, ""},
+		// negatives
+		{"-1ether", Wei, ""},
+		{"-1", Ether, ""},
+		// unknown units and malformed numbers
+		{"1 bitcoin", Wei, ""},
+		{"1e18", Wei, ""},
+		{"1.2.3ether", Wei, ""},
+		{".", Ether, ""},
+		{"ether", Wei, ""},
+		{"", Ether, ""},
+	}
+	for _, c := range cases {
+		a, err := ParseAmount(c.in, c.unit)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("ParseAmount(%q) = %s, want an error", c.in, a.Int())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %v", c.in, err)
+			continue
+		}
+		if a.Int().Cmp(wei(c.want)) != 0 {
+			t.Errorf("ParseAmount(%q) = %s wei, want %s", c.in, a.Int(), c.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	cases := []struct {
+		wei  string
+		want string
+	}{
+		{"1500000000000000000", "1.5 ether"},
+		{"20000000000000000", "0.02 ether"},
+		{"1000000000000000", "0.001 ether"},
+		{"999999999999999", "999999.999999999 gwei"},
+		{"20000000000", "20 gwei"},
+		{"1000000", "0.001 gwei"},
+		{"1000", "1000 wei"},
+		{"0", "0 wei"},
+	}
+	for _, c := range cases {
+		if got := NewAmount(wei(c.wei)).String(); got != c.want {
+			t.Errorf("String of %s wei = %q, want %q", c.wei, got, c.want)
+		}
+	}
+}
+
+func TestAmountIn(t *testing.T) {
+	a := NewAmount(wei("1234500000000000000"))
+	cases := []struct {
+		unit Unit
+		want string
+	}{
+		{Ether, "1.2345"},
+		{Finney, "1234.5"},
+		{Gwei, "1234500000"},
+		{Wei, "1234500000000000000"},
+	}
+	for _, c := range cases {
+		got := a.In(c.unit)
+		if got != c.want {
+			t.Errorf("In(%s) = %q, want %q", c.unit.Name, got, c.want)
+		}
+		back, err := ParseAmount(got+c.unit.Name, Wei)
+		if err != nil || back.Cmp(a) != 0 {
+			t.Errorf("ParseAmount(%q) = %v, %v, want %s wei", got+c.unit.Name, back, err, a.Int())
+		}
+	}
+}
+
+func TestAmountStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"1500000000000000000", "20000000000", "1000", "1", "123456789123456789123"} {
+		a := NewAmount(wei(s))
+		back, err := ParseAmount(a.String(), Wei)
+		if err != nil || back.Cmp(a) != 0 {
+			t.Errorf("ParseAmount(%q) = %v, %v, want %s wei", a.String(), back, err, s)
+		}
+	}
+}
+
+func TestAmountMarshalText(t *testing.T) {
+	type doc struct {
+		Amount *Amount
+	}
+	in := doc{Amount: MustParseAmount("1.5ether", Wei)}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Amount":"1500000000000000000"}` {
+		t.Errorf("json = %s", data)
+	}
+	var out doc
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Amount.Cmp(in.Amount) != 0 {
+		t.Errorf("round trip = %s, want %s", out.Amount, in.Amount)
+	}
+	// config files may use units, plain numbers are wei
+	if err := json.Unmarshal([]byte(`{"Amount":"20 gwei"}`), &out); err != nil || out.Amount.Int().Cmp(wei("20000000000")) != 0 {
+		t.Errorf("unmarshal 20 gwei = %v, %v", out.Amount, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Amount":"-1"}`), &out); err == nil {
+		t.Error("unmarshal -1 succeeded")
+	}
+}